@@ -1,13 +1,17 @@
 package multimap
 
 import (
+	"iter"
+	"slices"
+	"sort"
 	"sync"
 
 	set3 "github.com/TomTonic/Set3"
 )
 
 // arrayBasedMultiMap is the default implementation using a simple slice of key/value pairs.
-// It preserves previous behavior while satisfying the MultiMap interface.
+// It preserves previous behavior while satisfying the MultiMap interface. The slice is
+// kept sorted by key, so lookups use binary search and AllKeys needs no sorting.
 type arrayBasedMultiMap[T comparable] struct {
 	mu   sync.RWMutex
 	data []kvp[T]
@@ -27,69 +31,58 @@ func newArrayBased[T comparable]() *arrayBasedMultiMap[T] {
 func (m *arrayBasedMultiMap[T]) AddValue(key Key, v T) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	for i := range m.data {
-		if m.data[i].key.Equal(key) {
-			if m.data[i].val == nil {
-				m.data[i].val = set3.Empty[T]()
-			}
-			m.data[i].val.Add(v)
-			return
+	i, found := m.search(key)
+	if found {
+		if m.data[i].val == nil {
+			m.data[i].val = set3.Empty[T]()
 		}
+		m.data[i].val.Add(v)
+		return
 	}
 	newTuple := kvp[T]{
 		key: key.Clone(),
 		val: set3.Empty[T](),
 	}
 	newTuple.val.Add(v)
-	m.data = append(m.data, newTuple)
+	m.data = slices.Insert(m.data, i, newTuple)
+}
+
+// search returns the position of key in the sorted data slice and whether it
+// is present. If it is not, the position is where key would have to be
+// inserted. The caller must hold the lock.
+func (m *arrayBasedMultiMap[T]) search(key Key) (int, bool) {
+	return slices.BinarySearchFunc(m.data, key, func(kv kvp[T], k Key) int { return kv.key.Compare(k) })
 }
 
 func (m *arrayBasedMultiMap[T]) RemoveValue(key Key, v T) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	for i := range m.data {
-		if m.data[i].key.Equal(key) {
-			if m.data[i].val != nil {
-				m.data[i].val.Remove(v)
-			}
-			return
-		}
+	if i, found := m.search(key); found && m.data[i].val != nil {
+		m.data[i].val.Remove(v)
 	}
 }
 
 func (m *arrayBasedMultiMap[T]) ContainsKey(key Key) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	for i := range m.data {
-		if m.data[i].key.Equal(key) {
-			return true
-		}
-	}
-	return false
+	_, found := m.search(key)
+	return found
 }
 
 func (m *arrayBasedMultiMap[T]) RemoveKey(key Key) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	for i := range m.data {
-		if m.data[i].key.Equal(key) {
-			m.data[i] = m.data[len(m.data)-1]
-			m.data = m.data[:len(m.data)-1]
-			return
-		}
+	if i, found := m.search(key); found {
+		// shift instead of swapping with the last element to keep data sorted
+		m.data = slices.Delete(m.data, i, i+1)
 	}
 }
 
 func (m *arrayBasedMultiMap[T]) ValuesFor(key Key) *set3.Set3[T] {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	for i := range m.data {
-		if m.data[i].key.Equal(key) {
-			if m.data[i].val != nil {
-				return m.data[i].val.Clone()
-			}
-			return set3.EmptyWithCapacity[T](0)
-		}
+	if i, found := m.search(key); found && m.data[i].val != nil {
+		return m.data[i].val.Clone()
 	}
 	return set3.EmptyWithCapacity[T](0)
 }
@@ -190,6 +183,147 @@ func (m *arrayBasedMultiMap[T]) ValuesToExclusive(to Key) *set3.Set3[T] {
 	return result
 }
 
+func (m *arrayBasedMultiMap[T]) ValuesWithPrefix(prefix Key) *set3.Set3[T] {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := set3.Empty[T]()
+	for _, kv := range m.data {
+		if kv.key.HasPrefix(prefix) {
+			if kv.val != nil {
+				result.AddAll(kv.val)
+			}
+		}
+	}
+	return result
+}
+
+func (m *arrayBasedMultiMap[T]) Floor(key Key) (Key, *set3.Set3[T], bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	// the first key greater than key follows the floor
+	return m.entryAt(sort.Search(len(m.data), func(i int) bool { return !m.data[i].key.LessThanOrEqual(key) }) - 1)
+}
+
+func (m *arrayBasedMultiMap[T]) Ceiling(key Key) (Key, *set3.Set3[T], bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.entryAt(sort.Search(len(m.data), func(i int) bool { return key.LessThanOrEqual(m.data[i].key) }))
+}
+
+func (m *arrayBasedMultiMap[T]) Lower(key Key) (Key, *set3.Set3[T], bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	// the first key greater than or equal to key follows the lower key
+	return m.entryAt(sort.Search(len(m.data), func(i int) bool { return key.LessThanOrEqual(m.data[i].key) }) - 1)
+}
+
+func (m *arrayBasedMultiMap[T]) Higher(key Key) (Key, *set3.Set3[T], bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.entryAt(sort.Search(len(m.data), func(i int) bool { return !m.data[i].key.LessThanOrEqual(key) }))
+}
+
+func (m *arrayBasedMultiMap[T]) LongestPrefixMatch(key Key) (Key, *set3.Set3[T], bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	// prefixes of key are not greater than key, and longer prefixes sort after
+	// shorter ones, so the last match before the end of the search wins
+	best := -1
+	end, found := m.search(key)
+	if found {
+		end++
+	}
+	for i := 0; i < end; i++ {
+		if key.HasPrefix(m.data[i].key) {
+			best = i
+		}
+	}
+	return m.entryAt(best)
+}
+
+func (m *arrayBasedMultiMap[T]) FirstKey() (Key, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.data) == 0 {
+		return nil, false
+	}
+	return m.data[0].key.Clone(), true
+}
+
+func (m *arrayBasedMultiMap[T]) LastKey() (Key, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.data) == 0 {
+		return nil, false
+	}
+	return m.data[len(m.data)-1].key.Clone(), true
+}
+
+func (m *arrayBasedMultiMap[T]) PopFirst() (Key, *set3.Set3[T], bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.removeAt(0)
+}
+
+func (m *arrayBasedMultiMap[T]) PopLast() (Key, *set3.Set3[T], bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.removeAt(len(m.data) - 1)
+}
+
+// PopFirstMatching atomically removes the smallest key accepted by accept and
+// returns it with its values. Rejected keys are left in place. TypedMultiMap
+// uses it to skip keys its codec cannot decode. accept is called with the
+// lock held and must not call methods of m.
+func (m *arrayBasedMultiMap[T]) PopFirstMatching(accept func(Key) bool) (Key, *set3.Set3[T], bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.data {
+		if accept(m.data[i].key) {
+			return m.removeAt(i)
+		}
+	}
+	return m.entryAt(-1)
+}
+
+// PopLastMatching is like PopFirstMatching but removes the greatest accepted
+// key.
+func (m *arrayBasedMultiMap[T]) PopLastMatching(accept func(Key) bool) (Key, *set3.Set3[T], bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.data) - 1; i >= 0; i-- {
+		if accept(m.data[i].key) {
+			return m.removeAt(i)
+		}
+	}
+	return m.entryAt(-1)
+}
+
+// removeAt removes the entry at position i, if there is one, and returns it
+// like entryAt. slices.Delete zeroes the vacated slot, so the backing array
+// does not keep the removed key and values alive. The caller must hold the
+// write lock.
+func (m *arrayBasedMultiMap[T]) removeAt(i int) (Key, *set3.Set3[T], bool) {
+	key, values, found := m.entryAt(i)
+	if found {
+		m.data = slices.Delete(m.data, i, i+1)
+	}
+	return key, values, found
+}
+
+// entryAt returns clones of the key and the values at position i of the sorted
+// data slice, or nil, an empty set and false if i is out of bounds. The caller
+// must hold the lock.
+func (m *arrayBasedMultiMap[T]) entryAt(i int) (Key, *set3.Set3[T], bool) {
+	if i < 0 || i >= len(m.data) {
+		return nil, set3.EmptyWithCapacity[T](0), false
+	}
+	if m.data[i].val == nil {
+		return m.data[i].key.Clone(), set3.EmptyWithCapacity[T](0), true
+	}
+	return m.data[i].key.Clone(), m.data[i].val.Clone(), true
+}
+
 func (m *arrayBasedMultiMap[T]) NumberOfKeys() uint64 {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -206,8 +340,165 @@ func (m *arrayBasedMultiMap[T]) AllKeys() []Key {
 	return result
 }
 
+func (m *arrayBasedMultiMap[T]) All() iter.Seq2[Key, *set3.Set3[T]] {
+	return m.entries(func(Key) bool { return true })
+}
+
+// ViewAll calls f with an iterator over all keys and their values in
+// ascending order while holding the read lock, so f sees a consistent state
+// of m and writers block until f returns. The yielded keys and sets belong to
+// m and must not be modified or retained, and f must not write to m.
+// WriteBinary uses it to write consistent snapshots.
+func (m *arrayBasedMultiMap[T]) ViewAll(f func(all iter.Seq2[Key, *set3.Set3[T]]) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return f(func(yield func(Key, *set3.Set3[T]) bool) {
+		for _, kv := range m.data {
+			if kv.val != nil && !yield(kv.key, kv.val) {
+				return
+			}
+		}
+	})
+}
+
+func (m *arrayBasedMultiMap[T]) Range(from, to Key, inclusive bool) iter.Seq2[Key, *set3.Set3[T]] {
+	if inclusive {
+		return m.EntriesBetweenInclusive(from, to)
+	}
+	return m.EntriesBetweenExclusive(from, to)
+}
+
+func (m *arrayBasedMultiMap[T]) EntriesBetweenInclusive(from, to Key) iter.Seq2[Key, *set3.Set3[T]] {
+	return m.entries(func(k Key) bool { return from.LessThanOrEqual(k) && k.LessThanOrEqual(to) })
+}
+
+func (m *arrayBasedMultiMap[T]) EntriesBetweenExclusive(from, to Key) iter.Seq2[Key, *set3.Set3[T]] {
+	return m.entries(func(k Key) bool { return from.LessThan(k) && k.LessThan(to) })
+}
+
+func (m *arrayBasedMultiMap[T]) EntriesFromInclusive(from Key) iter.Seq2[Key, *set3.Set3[T]] {
+	return m.entries(func(k Key) bool { return from.LessThanOrEqual(k) })
+}
+
+func (m *arrayBasedMultiMap[T]) EntriesFromExclusive(from Key) iter.Seq2[Key, *set3.Set3[T]] {
+	return m.entries(func(k Key) bool { return from.LessThan(k) })
+}
+
+func (m *arrayBasedMultiMap[T]) EntriesToInclusive(to Key) iter.Seq2[Key, *set3.Set3[T]] {
+	return m.entries(func(k Key) bool { return k.LessThanOrEqual(to) })
+}
+
+func (m *arrayBasedMultiMap[T]) EntriesToExclusive(to Key) iter.Seq2[Key, *set3.Set3[T]] {
+	return m.entries(func(k Key) bool { return k.LessThan(to) })
+}
+
+func (m *arrayBasedMultiMap[T]) Keys() iter.Seq[Key] {
+	return func(yield func(Key) bool) {
+		for _, kv := range m.snapshot(func(Key) bool { return true }) {
+			if !yield(kv.key.Clone()) {
+				return
+			}
+		}
+	}
+}
+
+func (m *arrayBasedMultiMap[T]) KeysWithPrefix(prefix Key) iter.Seq[Key] {
+	return func(yield func(Key) bool) {
+		for _, kv := range m.snapshot(func(k Key) bool { return k.HasPrefix(prefix) }) {
+			if !yield(kv.key.Clone()) {
+				return
+			}
+		}
+	}
+}
+
+func (m *arrayBasedMultiMap[T]) Values() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for _, vals := range m.All() {
+			for v := range vals.MutableRange() {
+				if !yield(v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// entries returns an iterator over the keys matching pred and clones of their
+// value sets. The sets are cloned one at a time under the read lock, the lock
+// is not held while the caller's loop body runs.
+func (m *arrayBasedMultiMap[T]) entries(pred func(Key) bool) iter.Seq2[Key, *set3.Set3[T]] {
+	return func(yield func(Key, *set3.Set3[T]) bool) {
+		for _, kv := range m.snapshot(pred) {
+			m.mu.RLock()
+			vals := set3.EmptyWithCapacity[T](0)
+			if kv.val != nil {
+				vals = kv.val.Clone()
+			}
+			m.mu.RUnlock()
+			if !yield(kv.key.Clone(), vals) {
+				return
+			}
+		}
+	}
+}
+
+// snapshot returns a shallow copy of the entries whose keys match pred. Stored
+// keys are never modified, so the copy can be read without holding the lock;
+// the value sets must only be accessed under the lock.
+func (m *arrayBasedMultiMap[T]) snapshot(pred func(Key) bool) []kvp[T] {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]kvp[T], 0, len(m.data))
+	for _, kv := range m.data {
+		if pred(kv.key) {
+			result = append(result, kv)
+		}
+	}
+	return result
+}
+
 func (m *arrayBasedMultiMap[T]) Clear() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.data = make([]kvp[T], 0, 20)
 }
+
+// MarshalBinary implements encoding.BinaryMarshaler using the package-level
+// MarshalBinary.
+func (m *arrayBasedMultiMap[T]) MarshalBinary() ([]byte, error) {
+	return MarshalBinary[T](m)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler using the
+// package-level UnmarshalBinary. It replaces the contents of m; if data is
+// invalid, m is left unchanged.
+func (m *arrayBasedMultiMap[T]) UnmarshalBinary(data []byte) error {
+	loaded := newArrayBased[T]()
+	if err := UnmarshalBinary[T](data, loaded); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = loaded.data
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler using the package-level MarshalJSON.
+func (m *arrayBasedMultiMap[T]) MarshalJSON() ([]byte, error) {
+	return MarshalJSON[T](m)
+}
+
+// UnmarshalJSON implements json.Unmarshaler using the package-level
+// UnmarshalJSON. It replaces the contents of m; if data is invalid, m is left
+// unchanged.
+func (m *arrayBasedMultiMap[T]) UnmarshalJSON(data []byte) error {
+	loaded := newArrayBased[T]()
+	if err := UnmarshalJSON[T](data, loaded); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = loaded.data
+	return nil
+}
@@ -33,10 +33,18 @@ func (n *Node[T]) setNodeType(nt NodeType) *Node[T] {
 	return n
 }
 
+// GetPrefixLen returns the number of prefix bytes stored inline.
 func (n *Node[T]) GetPrefixLen() uint8 {
 	return n.meta & 0x0F
 }
 
+// fullPrefixLen returns the length of the whole compressed path of n,
+// including the bytes that are not stored inline.
+func (n *Node[T]) fullPrefixLen() int {
+	return int(n.prefixLen)
+}
+
+// GetPrefix returns a copy of the prefix bytes stored inline.
 func (n *Node[T]) GetPrefix() []byte {
 	l := n.GetPrefixLen()
 	k := make([]byte, l)
@@ -52,8 +60,61 @@ func (n *Node[T]) appendLocalPrefixTo(parentKey mm.Key) mm.Key {
 	return result
 }
 
+// appendPrefixTo appends the compressed path of n to parentKey. Bytes beyond
+// the inline part are not stored in the node; they are copied from searchKey
+// (optimistic path compression) and must be verified against the full key
+// stored with the value once the search ends. If searchKey is too short, the
+// result is padded so that it cannot match searchKey.
+func (n *Node[T]) appendPrefixTo(parentKey mm.Key, searchKey mm.Key) mm.Key {
+	l := int(n.GetPrefixLen())
+	full := n.fullPrefixLen()
+	result := make([]byte, len(parentKey)+max(l, full))
+	copy(result, parentKey)
+	copy(result[len(parentKey):], n.localPrefix[:l])
+	if full > l && len(searchKey) > len(parentKey)+l {
+		copy(result[len(parentKey)+l:], searchKey[len(parentKey)+l:])
+	}
+	return result
+}
+
+// loadPrefix returns a copy of the whole compressed path of n. depth is the
+// length of the key of the parent of n. Bytes that are not stored inline are
+// taken from the key of any node with a value below n.
+func (n *Node[T]) loadPrefix(depth int) []byte {
+	full := n.fullPrefixLen()
+	prefix := make([]byte, full)
+	if full <= maxLocalPrefixLen {
+		copy(prefix, n.localPrefix[:full])
+	} else {
+		copy(prefix, n.anyKey()[depth:depth+full])
+	}
+	return prefix
+}
+
+// anyKey returns the full key of n or of any node with a value below n. Every
+// node except an empty root has such a node in its subtree.
+func (n *Node[T]) anyKey() mm.Key {
+	for !n.HasValue() {
+		var next *Node[T]
+		n.forEachChild(func(_ byte, c *Node[T]) {
+			if next == nil {
+				next = c
+			}
+		})
+		if next == nil {
+			return nil
+		}
+		n = next
+	}
+	return n.value.key
+}
+
+// setPrefix stores prefix as the compressed path of n. Only the first
+// maxLocalPrefixLen bytes are kept inline, the full length is recorded in
+// prefixLen. The caller must ensure len(prefix) <= maxPrefixLen.
 func (n *Node[T]) setPrefix(prefix []byte) *Node[T] {
 	l := min(len(prefix), maxLocalPrefixLen)
+	n.prefixLen = uint16(len(prefix))
 	n.meta = (n.meta & 0xF0) | (uint8(l) & 0x0F)
 	// copy the provided bytes
 	copy(n.localPrefix[:], prefix[:l])
@@ -89,19 +150,23 @@ func (n *Node[T]) HasValue() bool {
 	return n.value != nil && n.value.Size() > 0
 }
 
+// holdsKey reports whether n has at least one value stored for key.
+func (n *Node[T]) holdsKey(key mm.Key) bool {
+	return n != nil && n.HasValue() && n.value.key.Equal(key)
+}
+
 func (n *Node[T]) AddValue(val T) {
 	if n.value == nil {
-		n.value = set3.Empty[T]()
+		n.value = &valueSet[T]{Set3: set3.Empty[T]()}
 	}
 	n.value.Add(val)
 }
 
 func (n *Node[T]) RemoveValue(val T) {
 	if n.value != nil {
-		if n.value.Size() <= 1 {
+		n.value.Remove(val)
+		if n.value.Size() == 0 {
 			n.value = nil
-		} else {
-			n.value.Remove(val)
 		}
 	}
 }
@@ -462,6 +462,21 @@ func TestNode_removeValue_nonExistent(t *testing.T) {
 	}
 }
 
+func TestNode_removeValue_nonExistentKeepsSingleValue(t *testing.T) {
+	node := &Node[int]{}
+	node.AddValue(100)
+
+	// Removing a value that doesn't exist must not drop the only stored value
+	node.RemoveValue(999)
+
+	if !node.HasValue() {
+		t.Fatalf("expected hasValue() = true after removing non-existent value")
+	}
+	if !node.value.Contains(100) {
+		t.Fatalf("expected value 100 to remain in set")
+	}
+}
+
 func TestNode_removeValue_fromEmpty(t *testing.T) {
 	node := &Node[int]{}
 
@@ -859,3 +874,58 @@ func TestNode_appendLocalPrefixTo_maxPrefix(t *testing.T) {
 		t.Fatalf("stored max prefix mismatch")
 	}
 }
+
+func TestNode_setPrefix_recordsFullLength(t *testing.T) {
+	long := make([]byte, maxLocalPrefixLen+20)
+	for i := range long {
+		long[i] = byte(i + 1)
+	}
+	node := &Node[int]{}
+	node.setPrefix(long)
+	if node.fullPrefixLen() != len(long) {
+		t.Fatalf("fullPrefixLen() = %d, want %d", node.fullPrefixLen(), len(long))
+	}
+	if int(node.GetPrefixLen()) != maxLocalPrefixLen {
+		t.Fatalf("inline length = %d, want %d", node.GetPrefixLen(), maxLocalPrefixLen)
+	}
+	node.setPrefix([]byte{1})
+	if node.fullPrefixLen() != 1 {
+		t.Fatalf("fullPrefixLen() = %d after shorter setPrefix, want 1", node.fullPrefixLen())
+	}
+}
+
+func TestNode_appendPrefixTo_takesSkippedBytesFromSearchKey(t *testing.T) {
+	long := make([]byte, maxLocalPrefixLen+4)
+	for i := range long {
+		long[i] = byte(i + 1)
+	}
+	node := &Node[int]{}
+	node.setPrefix(long)
+	parent := mm.Key{0xAA}
+
+	search := append(mm.Key{0xAA}, long...)
+	search[len(search)-1] = 0xEE // skipped byte differs, optimistic match anyway
+	out := node.appendPrefixTo(parent, search)
+	if !bytes.Equal(out, search) {
+		t.Fatalf("appendPrefixTo = %v, want %v", out, search)
+	}
+
+	short := search[:maxLocalPrefixLen]
+	out = node.appendPrefixTo(parent, short)
+	if len(out) != 1+len(long) {
+		t.Fatalf("expected padded result of length %d, got %d", 1+len(long), len(out))
+	}
+}
+
+func TestNode_loadPrefix_fromDescendantKey(t *testing.T) {
+	key := make(mm.Key, 30)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	node := &Node[int]{}
+	node.setPrefix(key[2:])
+	node.addValueFor(key, 1)
+	if got := node.loadPrefix(2); !bytes.Equal(got, key[2:]) {
+		t.Fatalf("loadPrefix() = %v, want %v", got, key[2:])
+	}
+}
@@ -0,0 +1,323 @@
+package art
+
+import mm "github.com/TomTonic/multimap"
+
+// remove looks up key in the subtree rooted at n and applies drop to the node
+// holding it. depth is the number of key bytes consumed by the ancestors of n.
+// It reports whether the key lost its last value. Children along the path are
+// compacted on the way back up; n itself is compacted by its caller.
+func (n *Node[T]) remove(key mm.Key, depth int, drop func(*Node[T])) bool {
+	// like getChild, only the inline part of the compressed path is compared;
+	// the full key is verified at the end
+	l := int(n.GetPrefixLen())
+	full := n.fullPrefixLen()
+	if depth+full > len(key) || int(mm.LongestCommonPrefix(n.localPrefix[:l], key[depth:])) < l {
+		return false
+	}
+
+	depth += full
+	if depth == len(key) {
+		// key ends exactly at n
+		if !n.holdsKey(key) {
+			return false
+		}
+		drop(n)
+		return !n.HasValue()
+	}
+
+	slot := n.findChildSlot(key[depth])
+	if slot == nil || !(*slot).remove(key, depth, drop) {
+		return false
+	}
+	if c := (*slot).compact(depth); c != nil {
+		*slot = c
+	} else {
+		n.removeChild(key[depth])
+	}
+	return true
+}
+
+// compact returns the node that replaces n in its parent after n lost a value
+// or a child. depth is the length of the key of the parent of n. It returns
+// nil if n holds neither a value nor children, merges a value-less n with its
+// only child, or demotes n to a smaller node type.
+func (n *Node[T]) compact(depth int) *Node[T] {
+	if !n.HasValue() {
+		switch n.childCount() {
+		case 0:
+			return nil
+		case 1:
+			if merged := n.mergeWithOnlyChild(depth); merged != nil {
+				return merged
+			}
+		}
+	}
+	return n.shrink()
+}
+
+// mergeWithOnlyChild prepends the compressed path of n to the compressed path
+// of its only child and returns the child. depth is the length of the key of
+// the parent of n. It returns nil if the combined path exceeds maxPrefixLen.
+func (n *Node[T]) mergeWithOnlyChild(depth int) *Node[T] {
+	var child *Node[T]
+	n.forEachChild(func(_ byte, c *Node[T]) { child = c })
+	merged := n.fullPrefixLen() + child.fullPrefixLen()
+	if merged > maxPrefixLen {
+		return nil
+	}
+	child.setPrefix(child.anyKey()[depth : depth+merged])
+	return child
+}
+
+// forEachChild calls f for every child of n together with its key byte.
+func (n *Node[T]) forEachChild(f func(b byte, child *Node[T])) {
+	switch n.GetNodeType() {
+	case NodeTypeLeaf:
+		if c := n.asLeaf().child; c != nil {
+			f(c.localPrefix[0], c)
+		}
+	case NodeType64:
+		x := n.asNode64()
+		for i := 0; i < int(x.numChildren); i++ {
+			f(x.firstKeyByte[i], x.child[i])
+		}
+	case NodeType128:
+		x := n.asNode128()
+		for i := 0; i < int(x.numChildren); i++ {
+			f(x.firstKeyByte[i], x.child[i])
+		}
+	case NodeType256:
+		x := n.asNode256()
+		for i := 0; i < int(x.numChildren); i++ {
+			f(x.firstKeyByte[i], x.child[i])
+		}
+	case NodeType512:
+		x := n.asNode512()
+		for i := 0; i < int(x.numChildren); i++ {
+			f(x.firstKeyByte[i], x.child[i])
+		}
+	case NodeType1024:
+		x := n.asNode1024()
+		for i := 0; i < int(x.numChildren); i++ {
+			f(x.firstKeyByte[i], x.child[i])
+		}
+	case FullNodeType:
+		x := n.asFullNode()
+		for b := 0; b < maxChildrenFullNode; b++ {
+			if x.child[b] != nil {
+				f(byte(b), x.child[b])
+			}
+		}
+	}
+}
+
+// removeChild removes the child stored under key byte b. Freed slots are
+// zeroed so no stale pointers are kept alive.
+func (n *Node[T]) removeChild(b byte) {
+	switch n.GetNodeType() {
+	case NodeTypeLeaf:
+		n.asLeaf().removeChild()
+	case NodeType64:
+		n.asNode64().removeChild(b)
+	case NodeType128:
+		n.asNode128().removeChild(b)
+	case NodeType256:
+		n.asNode256().removeChild(b)
+	case NodeType512:
+		n.asNode512().removeChild(b)
+	case NodeType1024:
+		n.asNode1024().removeChild(b)
+	case FullNodeType:
+		n.asFullNode().removeChild(b)
+	}
+}
+
+// shrink returns a copy of n converted to the next smaller node type if the
+// number of children dropped to the shrink threshold of its type, otherwise n.
+func (n *Node[T]) shrink() *Node[T] {
+	count := n.childCount()
+	switch n.GetNodeType() {
+	case NodeType64:
+		if count <= shrinkNode64ToLeaf {
+			return n.asNode64().shrink()
+		}
+	case NodeType128:
+		if count <= shrinkNode128To64 {
+			return n.asNode128().shrink()
+		}
+	case NodeType256:
+		if count <= shrinkNode256To128 {
+			return n.asNode256().shrink()
+		}
+	case NodeType512:
+		if count <= shrinkNode512To256 {
+			return n.asNode512().shrink()
+		}
+	case NodeType1024:
+		if count <= shrinkNode1024To512 {
+			return n.asNode1024().shrink()
+		}
+	case FullNodeType:
+		if count <= shrinkFullNodeTo1024 {
+			return n.asFullNode().shrink()
+		}
+	}
+	return n
+}
+
+// implementations for LeafNode
+
+func (n *LeafNode[T]) removeChild() {
+	n.child = nil
+	n.numChildren = 0
+}
+
+// implementations for nodes with multiple children
+// but without bitmap and with unsorted children
+// these are Node64, Node128, Node256
+// code is identical except for the node type
+
+func (n *Node64[T]) removeChild(b byte) {
+	last := int(n.numChildren) - 1
+	for i := 0; i <= last; i++ {
+		if n.firstKeyByte[i] == b {
+			// order does not matter -> move the last child into the gap
+			n.firstKeyByte[i] = n.firstKeyByte[last]
+			n.child[i] = n.child[last]
+			n.firstKeyByte[last] = 0
+			n.child[last] = nil
+			n.numChildren--
+			return
+		}
+	}
+}
+
+func (n *Node64[T]) shrink() *Node[T] {
+	nn := &LeafNode[T]{Node: n.Node}
+	nn.setNodeType(NodeTypeLeaf)
+	nn.numChildren = 0
+	if n.numChildren > 0 {
+		nn.addChild(n.child[0])
+	}
+	return nn.asNode()
+}
+
+func (n *Node128[T]) removeChild(b byte) {
+	last := int(n.numChildren) - 1
+	for i := 0; i <= last; i++ {
+		if n.firstKeyByte[i] == b {
+			// order does not matter -> move the last child into the gap
+			n.firstKeyByte[i] = n.firstKeyByte[last]
+			n.child[i] = n.child[last]
+			n.firstKeyByte[last] = 0
+			n.child[last] = nil
+			n.numChildren--
+			return
+		}
+	}
+}
+
+func (n *Node128[T]) shrink() *Node[T] {
+	nn := &Node64[T]{Node: n.Node}
+	nn.setNodeType(NodeType64)
+	copy(nn.firstKeyByte[:], n.firstKeyByte[:n.numChildren])
+	copy(nn.child[:], n.child[:n.numChildren])
+	return nn.asNode()
+}
+
+func (n *Node256[T]) removeChild(b byte) {
+	last := int(n.numChildren) - 1
+	for i := 0; i <= last; i++ {
+		if n.firstKeyByte[i] == b {
+			// order does not matter -> move the last child into the gap
+			n.firstKeyByte[i] = n.firstKeyByte[last]
+			n.child[i] = n.child[last]
+			n.firstKeyByte[last] = 0
+			n.child[last] = nil
+			n.numChildren--
+			return
+		}
+	}
+}
+
+func (n *Node256[T]) shrink() *Node[T] {
+	nn := &Node128[T]{Node: n.Node}
+	nn.setNodeType(NodeType128)
+	copy(nn.firstKeyByte[:], n.firstKeyByte[:n.numChildren])
+	copy(nn.child[:], n.child[:n.numChildren])
+	return nn.asNode()
+}
+
+// implementations for nodes with multiple children
+// with bitmap and sorted children
+// these are Node512, Node1024
+// code is identical except for the node type
+
+func (n *Node512[T]) removeChild(b byte) {
+	if !n.bitmap.Get(b) {
+		return
+	}
+	pos := n.binarySearchKeyByte(b)
+	last := int(n.numChildren) - 1
+	// shift the tail to keep firstKeyByte[] sorted
+	copy(n.firstKeyByte[pos:last], n.firstKeyByte[pos+1:last+1])
+	copy(n.child[pos:last], n.child[pos+1:last+1])
+	n.firstKeyByte[last] = 0
+	n.child[last] = nil
+	n.bitmap.Clear(b)
+	n.numChildren--
+}
+
+func (n *Node512[T]) shrink() *Node[T] {
+	// Node256 does not need sorted children, the sorted order is kept anyway
+	nn := &Node256[T]{Node: n.Node}
+	nn.setNodeType(NodeType256)
+	copy(nn.firstKeyByte[:], n.firstKeyByte[:n.numChildren])
+	copy(nn.child[:], n.child[:n.numChildren])
+	return nn.asNode()
+}
+
+func (n *Node1024[T]) removeChild(b byte) {
+	if !n.bitmap.Get(b) {
+		return
+	}
+	pos := n.binarySearchKeyByte(b)
+	last := int(n.numChildren) - 1
+	// shift the tail to keep firstKeyByte[] sorted
+	copy(n.firstKeyByte[pos:last], n.firstKeyByte[pos+1:last+1])
+	copy(n.child[pos:last], n.child[pos+1:last+1])
+	n.firstKeyByte[last] = 0
+	n.child[last] = nil
+	n.bitmap.Clear(b)
+	n.numChildren--
+}
+
+func (n *Node1024[T]) shrink() *Node[T] {
+	nn := &Node512[T]{Node: n.Node, bitmap: n.bitmap}
+	nn.setNodeType(NodeType512)
+	copy(nn.firstKeyByte[:], n.firstKeyByte[:n.numChildren])
+	copy(nn.child[:], n.child[:n.numChildren])
+	return nn.asNode()
+}
+
+// implementations for FullNode
+
+func (n *FullNode[T]) removeChild(b byte) {
+	n.child[b] = nil
+	n.bitmap.Clear(b)
+}
+
+func (n *FullNode[T]) shrink() *Node[T] {
+	// walking the child array in index order yields sorted key bytes
+	nn := &Node1024[T]{Node: n.Node, bitmap: n.bitmap}
+	nn.setNodeType(NodeType1024)
+	nn.numChildren = 0
+	for b := 0; b < maxChildrenFullNode; b++ {
+		if n.child[b] != nil {
+			nn.firstKeyByte[nn.numChildren] = byte(b)
+			nn.child[nn.numChildren] = n.child[b]
+			nn.numChildren++
+		}
+	}
+	return nn.asNode()
+}
@@ -0,0 +1,226 @@
+package art
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	set3 "github.com/TomTonic/Set3"
+	mm "github.com/TomTonic/multimap"
+)
+
+func TestTree_Delete_existingAndMissing(t *testing.T) {
+	tree := NewTree[int]()
+	tree.Insert(mm.FromString("a"), 1)
+	tree.Insert(mm.FromString("ab"), 2)
+
+	if tree.Delete(mm.FromString("b")) {
+		t.Fatalf("Delete of missing key reported success")
+	}
+	if tree.Delete(mm.FromString("abc")) {
+		t.Fatalf("Delete of missing longer key reported success")
+	}
+	if !tree.Delete(mm.FromString("a")) {
+		t.Fatalf("Delete of existing key reported failure")
+	}
+	if tree.Delete(mm.FromString("a")) {
+		t.Fatalf("second Delete of same key reported success")
+	}
+	if tree.Contains(mm.FromString("a")) || !tree.Contains(mm.FromString("ab")) {
+		t.Fatalf("Delete removed wrong key")
+	}
+	if tree.Size() != 1 {
+		t.Fatalf("expected size 1, got %d", tree.Size())
+	}
+	checkInvariants(t, tree.root, true)
+}
+
+func TestTree_Delete_emptyKey(t *testing.T) {
+	tree := NewTree[int]()
+	tree.Insert(mm.Key{}, 1)
+	tree.Insert(mm.Key{1}, 2)
+	if !tree.Delete(mm.Key{}) {
+		t.Fatalf("Delete of empty key reported failure")
+	}
+	if tree.Contains(mm.Key{}) || !tree.Contains(mm.Key{1}) {
+		t.Fatalf("Delete of empty key removed wrong key")
+	}
+	if tree.root.GetPrefixLen() != 0 {
+		t.Fatalf("root must keep an empty prefix")
+	}
+	checkInvariants(t, tree.root, true)
+}
+
+func TestTree_RemoveValue_lastValueRemovesKey(t *testing.T) {
+	tree := NewTree[int]()
+	k := mm.FromString("key")
+	tree.Insert(k, 1)
+	tree.Insert(k, 2)
+
+	tree.RemoveValue(k, 1)
+	if !tree.Get(k).Equals(set3.From(2)) || tree.Size() != 1 {
+		t.Fatalf("expected {2} after removing one value")
+	}
+	tree.RemoveValue(k, 42) // non-existent value is a no-op
+	if !tree.Get(k).Equals(set3.From(2)) {
+		t.Fatalf("removing non-existent value changed the set")
+	}
+	tree.RemoveValue(k, 2)
+	if tree.Contains(k) || tree.Size() != 0 {
+		t.Fatalf("expected key to be removed with its last value")
+	}
+	if tree.root.childCount() != 0 {
+		t.Fatalf("expected empty root after removing the only key")
+	}
+}
+
+func TestTree_Delete_mergesSingleChildIntoPrefix(t *testing.T) {
+	tree := NewTree[int]()
+	tree.Insert(mm.Key{1, 2, 3}, 1)
+	tree.Insert(mm.Key{1, 2, 4}, 2)
+	inner := *tree.root.findChildSlot(1)
+	if !bytes.Equal(inner.GetPrefix(), []byte{1, 2}) {
+		t.Fatalf("expected split node with prefix [1,2], got %v", inner.GetPrefix())
+	}
+
+	tree.Delete(mm.Key{1, 2, 4})
+	merged := *tree.root.findChildSlot(1)
+	if !bytes.Equal(merged.GetPrefix(), []byte{1, 2, 3}) {
+		t.Fatalf("expected merged prefix [1,2,3], got %v", merged.GetPrefix())
+	}
+	if merged.childCount() != 0 || !merged.GetValues().Equals(set3.From(1)) {
+		t.Fatalf("merged node lost its value or kept stale children")
+	}
+	checkInvariants(t, tree.root, true)
+}
+
+func TestTree_Delete_keepsInnerNodeWithValue(t *testing.T) {
+	tree := NewTree[int]()
+	tree.Insert(mm.Key{1, 2}, 1)
+	tree.Insert(mm.Key{1, 2, 3}, 2)
+	tree.Insert(mm.Key{1, 2, 4}, 3)
+
+	tree.Delete(mm.Key{1, 2, 4})
+	if !tree.Get(mm.Key{1, 2}).Equals(set3.From(1)) || !tree.Get(mm.Key{1, 2, 3}).Equals(set3.From(2)) {
+		t.Fatalf("unexpected content after delete")
+	}
+	tree.Delete(mm.Key{1, 2})
+	if !tree.Get(mm.Key{1, 2, 3}).Equals(set3.From(2)) {
+		t.Fatalf("deleting inner key lost its descendant")
+	}
+	if checkInvariants(t, tree.root, true) != 1 {
+		t.Fatalf("expected exactly one key left")
+	}
+}
+
+func TestTree_Delete_shrinksThroughAllNodeTypes(t *testing.T) {
+	tree := NewTree[int]()
+	for i := 0; i < maxChildrenFullNode; i++ {
+		tree.Insert(mm.Key{byte(i), 0x42}, i)
+	}
+	expected := []struct {
+		children int
+		kind     NodeType
+	}{
+		{shrinkFullNodeTo1024, NodeType1024},
+		{shrinkNode1024To512, NodeType512},
+		{shrinkNode512To256, NodeType256},
+		{shrinkNode256To128, NodeType128},
+		{shrinkNode128To64, NodeType64},
+		{shrinkNode64ToLeaf, NodeTypeLeaf},
+	}
+	remaining := maxChildrenFullNode
+	for _, e := range expected {
+		for remaining > e.children {
+			remaining--
+			// delete from the middle so that sorted node types have to shift children
+			b := byte((remaining * 7) % maxChildrenFullNode)
+			for !tree.Contains(mm.Key{b, 0x42}) {
+				b++
+			}
+			if !tree.Delete(mm.Key{b, 0x42}) {
+				t.Fatalf("Delete(%d) failed", b)
+			}
+		}
+		if tree.root.GetNodeType() != e.kind {
+			t.Fatalf("with %d children root is %v, want %v", remaining, tree.root.GetNodeType(), e.kind)
+		}
+		if got := checkInvariants(t, tree.root, true); got != uint64(remaining) {
+			t.Fatalf("found %d keys, want %d", got, remaining)
+		}
+	}
+}
+
+func TestTree_Delete_hysteresis(t *testing.T) {
+	tree := NewTree[int]()
+	for i := 0; i <= maxChildrenNode64; i++ {
+		tree.Insert(mm.Key{byte(i)}, i)
+	}
+	if tree.root.GetNodeType() != NodeType128 {
+		t.Fatalf("expected Node128 root, got %v", tree.root.GetNodeType())
+	}
+	root := tree.root
+	flip := mm.Key{maxChildrenNode64}
+	for i := 0; i < 10; i++ {
+		tree.Delete(flip)
+		tree.Insert(flip, i)
+		if tree.root != root {
+			t.Fatalf("flipping a single key reallocated the root node")
+		}
+	}
+}
+
+func TestTree_Delete_randomChurn(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	tree := NewTree[int]()
+	reference := map[string]*set3.Set3[int]{}
+	randomKey := func() mm.Key {
+		k := make(mm.Key, rng.Intn(24))
+		for j := range k {
+			k[j] = byte(rng.Intn(6))
+		}
+		return k
+	}
+	for i := 0; i < 20000; i++ {
+		k := randomKey()
+		switch rng.Intn(3) {
+		case 0:
+			tree.Insert(k, i%5)
+			if reference[string(k)] == nil {
+				reference[string(k)] = set3.Empty[int]()
+			}
+			reference[string(k)].Add(i % 5)
+		case 1:
+			existed := reference[string(k)] != nil
+			if tree.Delete(k) != existed {
+				t.Fatalf("Delete(%v) returned %v, want %v", k, !existed, existed)
+			}
+			delete(reference, string(k))
+		case 2:
+			tree.RemoveValue(k, i%5)
+			if s := reference[string(k)]; s != nil {
+				s.Remove(i % 5)
+				if s.Size() == 0 {
+					delete(reference, string(k))
+				}
+			}
+		}
+	}
+	if tree.Size() != uint64(len(reference)) {
+		t.Fatalf("size = %d, want %d", tree.Size(), len(reference))
+	}
+	if checkInvariants(t, tree.root, true) != tree.Size() {
+		t.Fatalf("number of value nodes does not match size")
+	}
+	for k, want := range reference {
+		if !tree.Get(mm.Key(k)).Equals(want) {
+			t.Fatalf("Get(%v) returned unexpected set", mm.Key(k))
+		}
+	}
+	for k := range reference {
+		tree.Delete(mm.Key(k))
+	}
+	if tree.root.childCount() != 0 || tree.root.HasValue() {
+		t.Fatalf("tree not empty after deleting all keys")
+	}
+}
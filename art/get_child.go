@@ -6,6 +6,10 @@ import (
 	mm "github.com/TomTonic/multimap"
 )
 
+// getChild returns the node whose path spells searchKey, or nil. Compressed
+// path bytes that are not stored inline are not compared (optimistic path
+// compression), so callers must verify the full key stored with the value of
+// the returned node, see Node.holdsKey.
 func (n *Node[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *Node[T]) {
 	switch n.GetNodeType() {
 	case NodeTypeLeaf:
@@ -27,7 +31,7 @@ func (n *Node[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *Node[
 }
 
 func (n *LeafNode[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *Node[T]) {
-	lokalKey := n.appendLocalPrefixTo(currentPrefix)
+	lokalKey := n.appendPrefixTo(currentPrefix, searchKey)
 	lcp := mm.LongestCommonPrefix(lokalKey, searchKey)
 	llk := uint(len(lokalKey))
 	lsk := uint(len(searchKey))
@@ -60,7 +64,7 @@ func (n *LeafNode[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *N
 // code is identical except for the node type
 
 func (n *Node64[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *Node[T]) {
-	lokalKey := n.appendLocalPrefixTo(currentPrefix)
+	lokalKey := n.appendPrefixTo(currentPrefix, searchKey)
 	lcp := mm.LongestCommonPrefix(lokalKey, searchKey)
 	llk := uint(len(lokalKey))
 	lsk := uint(len(searchKey))
@@ -90,7 +94,7 @@ func (n *Node64[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *Nod
 }
 
 func (n *Node128[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *Node[T]) {
-	lokalKey := n.appendLocalPrefixTo(currentPrefix)
+	lokalKey := n.appendPrefixTo(currentPrefix, searchKey)
 	lcp := mm.LongestCommonPrefix(lokalKey, searchKey)
 	llk := uint(len(lokalKey))
 	lsk := uint(len(searchKey))
@@ -120,7 +124,7 @@ func (n *Node128[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *No
 }
 
 func (n *Node256[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *Node[T]) {
-	lokalKey := n.appendLocalPrefixTo(currentPrefix)
+	lokalKey := n.appendPrefixTo(currentPrefix, searchKey)
 	lcp := mm.LongestCommonPrefix(lokalKey, searchKey)
 	llk := uint(len(lokalKey))
 	lsk := uint(len(searchKey))
@@ -155,7 +159,7 @@ func (n *Node256[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *No
 // code is identical except for the node type
 
 func (n *Node512[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *Node[T]) {
-	lokalKey := n.appendLocalPrefixTo(currentPrefix)
+	lokalKey := n.appendPrefixTo(currentPrefix, searchKey)
 	lcp := mm.LongestCommonPrefix(lokalKey, searchKey)
 	llk := uint(len(lokalKey))
 	lsk := uint(len(searchKey))
@@ -207,7 +211,7 @@ func (n *Node512[T]) binarySearchKeyByte(target byte) (position int) {
 }
 
 func (n *Node1024[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *Node[T]) {
-	lokalKey := n.appendLocalPrefixTo(currentPrefix)
+	lokalKey := n.appendPrefixTo(currentPrefix, searchKey)
 	lcp := mm.LongestCommonPrefix(lokalKey, searchKey)
 	llk := uint(len(lokalKey))
 	lsk := uint(len(searchKey))
@@ -261,7 +265,7 @@ func (n *Node1024[T]) binarySearchKeyByte(target byte) (position int) {
 // implementations for FullNode
 
 func (n *FullNode[T]) getChild(currentPrefix mm.Key, searchKey mm.Key) (child *Node[T]) {
-	lokalKey := n.appendLocalPrefixTo(currentPrefix)
+	lokalKey := n.appendPrefixTo(currentPrefix, searchKey)
 	lcp := mm.LongestCommonPrefix(lokalKey, searchKey)
 	llk := uint(len(lokalKey))
 	lsk := uint(len(searchKey))
@@ -0,0 +1,366 @@
+package art
+
+import mm "github.com/TomTonic/multimap"
+
+// Constructors. Every node starts with the given prefix, no value and no children.
+
+func newLeafNode[T comparable](prefix []byte) *LeafNode[T] {
+	n := &LeafNode[T]{}
+	n.setNodeType(NodeTypeLeaf).setPrefix(prefix)
+	return n
+}
+
+func newNode64[T comparable](prefix []byte) *Node64[T] {
+	n := &Node64[T]{}
+	n.setNodeType(NodeType64).setPrefix(prefix)
+	return n
+}
+
+// newLeafChain returns a leaf node whose compressed path spells suffix and
+// which stores value for key. Suffixes longer than maxPrefixLen are split
+// across several chained leaves.
+func newLeafChain[T comparable](suffix []byte, key mm.Key, value T) *Node[T] {
+	l := min(len(suffix), maxPrefixLen)
+	leaf := newLeafNode[T](suffix[:l])
+	if len(suffix) > l {
+		leaf.child = newLeafChain(suffix[l:], key, value)
+		leaf.numChildren = 1
+	} else {
+		leaf.addValueFor(key, value)
+	}
+	return leaf.asNode()
+}
+
+// addValueFor adds value to n and records key as the full key of n.
+func (n *Node[T]) addValueFor(key mm.Key, value T) {
+	n.AddValue(value)
+	if n.value.key == nil {
+		n.value.key = mm.FromBytes(key)
+	}
+}
+
+// insert adds value at key in the subtree rooted at n. depth is the number of
+// key bytes consumed by the ancestors of n. It returns the node that replaces n
+// in its parent (n itself unless n was split or grown) and whether a new key
+// was created.
+func (n *Node[T]) insert(key mm.Key, depth int, value T) (*Node[T], bool) {
+	// insertion is pessimistic: the whole compressed path is compared, including
+	// the bytes that are not stored inline
+	prefix := n.loadPrefix(depth)
+	rest := key[depth:]
+	lcp := int(mm.LongestCommonPrefix(prefix, rest))
+
+	if lcp < len(prefix) {
+		// key leaves the compressed path of n -> split the path at lcp
+		return n.split(prefix, lcp, key, depth+lcp, value), true
+	}
+
+	depth += lcp
+	if depth == len(key) {
+		// key ends exactly at n
+		created := !n.HasValue()
+		n.addValueFor(key, value)
+		return n, created
+	}
+
+	if slot := n.findChildSlot(key[depth]); slot != nil {
+		var created bool
+		*slot, created = (*slot).insert(key, depth, value)
+		return n, created
+	}
+
+	if n.isFull() {
+		n = n.grow()
+	}
+	n.addChild(key[depth], newLeafChain(key[depth:], key, value))
+	return n, true
+}
+
+// split shortens the compressed path of n to prefix[lcp:] and returns a new
+// parent holding prefix[:lcp]. depth is the position in key right after the
+// common part. If key ends there, the new parent stores value itself,
+// otherwise it gets a second child spelling the rest of key.
+func (n *Node[T]) split(prefix []byte, lcp int, key mm.Key, depth int, value T) *Node[T] {
+	n.setPrefix(prefix[lcp:])
+	if depth == len(key) {
+		parent := newLeafNode[T](prefix[:lcp])
+		parent.addValueFor(key, value)
+		parent.child = n
+		parent.numChildren = 1
+		return parent.asNode()
+	}
+	parent := newNode64[T](prefix[:lcp])
+	parent.addChild(prefix[lcp], n)
+	parent.addChild(key[depth], newLeafChain(key[depth:], key, value))
+	return parent.asNode()
+}
+
+// childCount returns the number of children of n. FullNode does not track its
+// child count in numChildren (256 does not fit into a byte) but in its bitmap.
+func (n *Node[T]) childCount() int {
+	if n.GetNodeType() == FullNodeType {
+		return n.asFullNode().bitmap.Count()
+	}
+	return int(n.numChildren)
+}
+
+// isFull reports whether n has no room for another child.
+func (n *Node[T]) isFull() bool {
+	return uint(n.childCount()) >= n.GetMaxChildren()
+}
+
+// findChildSlot returns a pointer to the child slot for the child whose prefix
+// starts with b, or nil if there is no such child.
+func (n *Node[T]) findChildSlot(b byte) **Node[T] {
+	switch n.GetNodeType() {
+	case NodeTypeLeaf:
+		return n.asLeaf().findChildSlot(b)
+	case NodeType64:
+		return n.asNode64().findChildSlot(b)
+	case NodeType128:
+		return n.asNode128().findChildSlot(b)
+	case NodeType256:
+		return n.asNode256().findChildSlot(b)
+	case NodeType512:
+		return n.asNode512().findChildSlot(b)
+	case NodeType1024:
+		return n.asNode1024().findChildSlot(b)
+	case FullNodeType:
+		return n.asFullNode().findChildSlot(b)
+	}
+	return nil
+}
+
+// addChild adds child under key byte b. The caller must make sure that n is
+// not full and that no child for b exists yet.
+func (n *Node[T]) addChild(b byte, child *Node[T]) {
+	switch n.GetNodeType() {
+	case NodeTypeLeaf:
+		n.asLeaf().addChild(child)
+	case NodeType64:
+		n.asNode64().addChild(b, child)
+	case NodeType128:
+		n.asNode128().addChild(b, child)
+	case NodeType256:
+		n.asNode256().addChild(b, child)
+	case NodeType512:
+		n.asNode512().addChild(b, child)
+	case NodeType1024:
+		n.asNode1024().addChild(b, child)
+	case FullNodeType:
+		n.asFullNode().addChild(b, child)
+	}
+}
+
+// grow returns a copy of n converted to the next larger node type. Prefix,
+// value and all children are carried over. FullNode cannot grow any further.
+func (n *Node[T]) grow() *Node[T] {
+	switch n.GetNodeType() {
+	case NodeTypeLeaf:
+		return n.asLeaf().grow()
+	case NodeType64:
+		return n.asNode64().grow()
+	case NodeType128:
+		return n.asNode128().grow()
+	case NodeType256:
+		return n.asNode256().grow()
+	case NodeType512:
+		return n.asNode512().grow()
+	case NodeType1024:
+		return n.asNode1024().grow()
+	}
+	panic("node of kind " + n.GetNodeType().String() + " cannot grow")
+}
+
+// implementations for LeafNode
+
+func (n *LeafNode[T]) findChildSlot(b byte) **Node[T] {
+	// unlike the other node types, a leaf does not store the key byte of its
+	// child, so it is taken from the child's prefix
+	if n.child != nil && n.child.GetPrefixLen() > 0 && n.child.localPrefix[0] == b {
+		return &n.child
+	}
+	return nil
+}
+
+func (n *LeafNode[T]) addChild(child *Node[T]) {
+	n.child = child
+	n.numChildren = 1
+}
+
+func (n *LeafNode[T]) grow() *Node[T] {
+	nn := &Node64[T]{Node: n.Node}
+	nn.setNodeType(NodeType64)
+	nn.numChildren = 0
+	if n.child != nil {
+		nn.addChild(n.child.localPrefix[0], n.child)
+	}
+	return nn.asNode()
+}
+
+// implementations for nodes with multiple children
+// but without bitmap and with unsorted children
+// these are Node64, Node128, Node256
+// code is identical except for the node type
+
+func (n *Node64[T]) findChildSlot(b byte) **Node[T] {
+	for i := 0; i < int(n.numChildren); i++ {
+		if n.firstKeyByte[i] == b && n.child[i] != nil {
+			return &n.child[i]
+		}
+	}
+	return nil
+}
+
+func (n *Node64[T]) addChild(b byte, child *Node[T]) {
+	n.firstKeyByte[n.numChildren] = b
+	n.child[n.numChildren] = child
+	n.numChildren++
+}
+
+func (n *Node64[T]) grow() *Node[T] {
+	nn := &Node128[T]{Node: n.Node}
+	nn.setNodeType(NodeType128)
+	copy(nn.firstKeyByte[:], n.firstKeyByte[:n.numChildren])
+	copy(nn.child[:], n.child[:n.numChildren])
+	return nn.asNode()
+}
+
+func (n *Node128[T]) findChildSlot(b byte) **Node[T] {
+	for i := 0; i < int(n.numChildren); i++ {
+		if n.firstKeyByte[i] == b && n.child[i] != nil {
+			return &n.child[i]
+		}
+	}
+	return nil
+}
+
+func (n *Node128[T]) addChild(b byte, child *Node[T]) {
+	n.firstKeyByte[n.numChildren] = b
+	n.child[n.numChildren] = child
+	n.numChildren++
+}
+
+func (n *Node128[T]) grow() *Node[T] {
+	nn := &Node256[T]{Node: n.Node}
+	nn.setNodeType(NodeType256)
+	copy(nn.firstKeyByte[:], n.firstKeyByte[:n.numChildren])
+	copy(nn.child[:], n.child[:n.numChildren])
+	return nn.asNode()
+}
+
+func (n *Node256[T]) findChildSlot(b byte) **Node[T] {
+	for i := 0; i < int(n.numChildren); i++ {
+		if n.firstKeyByte[i] == b && n.child[i] != nil {
+			return &n.child[i]
+		}
+	}
+	return nil
+}
+
+func (n *Node256[T]) addChild(b byte, child *Node[T]) {
+	n.firstKeyByte[n.numChildren] = b
+	n.child[n.numChildren] = child
+	n.numChildren++
+}
+
+func (n *Node256[T]) grow() *Node[T] {
+	// Node512 keeps its children sorted, so insert them one by one
+	nn := &Node512[T]{Node: n.Node}
+	nn.setNodeType(NodeType512)
+	nn.numChildren = 0
+	for i := 0; i < int(n.numChildren); i++ {
+		nn.addChild(n.firstKeyByte[i], n.child[i])
+	}
+	return nn.asNode()
+}
+
+// implementations for nodes with multiple children
+// with bitmap and sorted children
+// these are Node512, Node1024
+// code is identical except for the node type
+
+func (n *Node512[T]) findChildSlot(b byte) **Node[T] {
+	if !n.bitmap.Get(b) {
+		return nil
+	}
+	position := n.binarySearchKeyByte(b)
+	if position < 0 {
+		panic("structural problem: presence bit set but key byte not found")
+	}
+	return &n.child[position]
+}
+
+func (n *Node512[T]) addChild(b byte, child *Node[T]) {
+	// find the insert position and shift the tail to keep firstKeyByte[] sorted
+	num := int(n.numChildren)
+	pos := 0
+	for pos < num && n.firstKeyByte[pos] < b {
+		pos++
+	}
+	copy(n.firstKeyByte[pos+1:num+1], n.firstKeyByte[pos:num])
+	copy(n.child[pos+1:num+1], n.child[pos:num])
+	n.firstKeyByte[pos] = b
+	n.child[pos] = child
+	n.bitmap.Set(b)
+	n.numChildren++
+}
+
+func (n *Node512[T]) grow() *Node[T] {
+	nn := &Node1024[T]{Node: n.Node, bitmap: n.bitmap}
+	nn.setNodeType(NodeType1024)
+	copy(nn.firstKeyByte[:], n.firstKeyByte[:n.numChildren])
+	copy(nn.child[:], n.child[:n.numChildren])
+	return nn.asNode()
+}
+
+func (n *Node1024[T]) findChildSlot(b byte) **Node[T] {
+	if !n.bitmap.Get(b) {
+		return nil
+	}
+	position := n.binarySearchKeyByte(b)
+	if position < 0 {
+		panic("structural problem: presence bit set but key byte not found")
+	}
+	return &n.child[position]
+}
+
+func (n *Node1024[T]) addChild(b byte, child *Node[T]) {
+	// find the insert position and shift the tail to keep firstKeyByte[] sorted
+	num := int(n.numChildren)
+	pos := 0
+	for pos < num && n.firstKeyByte[pos] < b {
+		pos++
+	}
+	copy(n.firstKeyByte[pos+1:num+1], n.firstKeyByte[pos:num])
+	copy(n.child[pos+1:num+1], n.child[pos:num])
+	n.firstKeyByte[pos] = b
+	n.child[pos] = child
+	n.bitmap.Set(b)
+	n.numChildren++
+}
+
+func (n *Node1024[T]) grow() *Node[T] {
+	nn := &FullNode[T]{Node: n.Node, bitmap: n.bitmap}
+	nn.setNodeType(FullNodeType)
+	nn.numChildren = 0 // not maintained for FullNode, see childCount()
+	nn.child = new([maxChildrenFullNode]*Node[T])
+	for i := 0; i < int(n.numChildren); i++ {
+		nn.child[n.firstKeyByte[i]] = n.child[i]
+	}
+	return nn.asNode()
+}
+
+// implementations for FullNode
+
+func (n *FullNode[T]) findChildSlot(b byte) **Node[T] {
+	if !n.bitmap.Get(b) || n.child[b] == nil {
+		return nil
+	}
+	return &n.child[b]
+}
+
+func (n *FullNode[T]) addChild(b byte, child *Node[T]) {
+	n.child[b] = child
+	n.bitmap.Set(b)
+}
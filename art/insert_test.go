@@ -0,0 +1,335 @@
+package art
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	set3 "github.com/TomTonic/Set3"
+	mm "github.com/TomTonic/multimap"
+)
+
+// checkInvariants walks the whole tree and fails the test if any structural
+// invariant is violated. It returns the number of nodes holding a value.
+func checkInvariants[T comparable](t *testing.T, n *Node[T], isRoot bool) uint64 {
+	t.Helper()
+	if !isRoot && n.GetPrefixLen() == 0 {
+		t.Fatalf("non-root node of kind %v has empty prefix", n.GetNodeType())
+	}
+	if uint(n.childCount()) > n.GetMaxChildren() {
+		t.Fatalf("node of kind %v has %d children, max is %d", n.GetNodeType(), n.childCount(), n.GetMaxChildren())
+	}
+	var keyBytes []byte
+	var children []*Node[T]
+	switch n.GetNodeType() {
+	case NodeTypeLeaf:
+		l := n.asLeaf()
+		if l.child != nil {
+			keyBytes = append(keyBytes, l.child.localPrefix[0])
+			children = append(children, l.child)
+		}
+	case NodeType64:
+		x := n.asNode64()
+		keyBytes, children = x.firstKeyByte[:x.numChildren], x.child[:x.numChildren]
+	case NodeType128:
+		x := n.asNode128()
+		keyBytes, children = x.firstKeyByte[:x.numChildren], x.child[:x.numChildren]
+	case NodeType256:
+		x := n.asNode256()
+		keyBytes, children = x.firstKeyByte[:x.numChildren], x.child[:x.numChildren]
+	case NodeType512:
+		x := n.asNode512()
+		keyBytes, children = x.firstKeyByte[:x.numChildren], x.child[:x.numChildren]
+		checkSortedWithBitmap(t, keyBytes, &x.bitmap)
+	case NodeType1024:
+		x := n.asNode1024()
+		keyBytes, children = x.firstKeyByte[:x.numChildren], x.child[:x.numChildren]
+		checkSortedWithBitmap(t, keyBytes, &x.bitmap)
+	case FullNodeType:
+		x := n.asFullNode()
+		for b := 0; b < maxChildrenFullNode; b++ {
+			if x.bitmap.Get(byte(b)) != (x.child[b] != nil) {
+				t.Fatalf("FullNode bitmap and child array disagree at byte %d", b)
+			}
+			if x.child[b] != nil {
+				keyBytes = append(keyBytes, byte(b))
+				children = append(children, x.child[b])
+			}
+		}
+	}
+	if !isRoot && !n.HasValue() && len(children) == 0 {
+		t.Fatalf("non-root node of kind %v holds neither a value nor children", n.GetNodeType())
+	}
+	count := uint64(0)
+	if n.HasValue() {
+		count++
+	}
+	for i, c := range children {
+		if c == nil {
+			t.Fatalf("node of kind %v has nil child at index %d", n.GetNodeType(), i)
+		}
+		if c.GetPrefixLen() == 0 || c.localPrefix[0] != keyBytes[i] {
+			t.Fatalf("child key byte 0x%02X does not match child prefix %v", keyBytes[i], c.GetPrefix())
+		}
+		count += checkInvariants(t, c, false)
+	}
+	return count
+}
+
+func checkSortedWithBitmap(t *testing.T, keyBytes []byte, bitmap *PresenceBitmap) {
+	t.Helper()
+	for i := 1; i < len(keyBytes); i++ {
+		if keyBytes[i-1] >= keyBytes[i] {
+			t.Fatalf("firstKeyByte not strictly sorted: %v", keyBytes)
+		}
+	}
+	if bitmap.Count() != len(keyBytes) {
+		t.Fatalf("bitmap has %d bits set, node has %d children", bitmap.Count(), len(keyBytes))
+	}
+	for _, b := range keyBytes {
+		if !bitmap.Get(b) {
+			t.Fatalf("bitmap bit for key byte 0x%02X not set", b)
+		}
+	}
+}
+
+func TestTree_Insert_emptyTree(t *testing.T) {
+	tree := NewTree[int]()
+	if tree.Size() != 0 {
+		t.Fatalf("expected empty tree, got size %d", tree.Size())
+	}
+	if tree.Contains(mm.FromString("a")) {
+		t.Fatalf("empty tree must not contain any key")
+	}
+	if tree.Get(mm.FromString("a")).Size() != 0 {
+		t.Fatalf("expected empty set for missing key")
+	}
+}
+
+func TestTree_Insert_emptyKey(t *testing.T) {
+	tree := NewTree[int]()
+	tree.Insert(mm.Key{}, 1)
+	tree.Insert(mm.FromString("a"), 2)
+	if !tree.Get(mm.Key{}).Equals(set3.From(1)) {
+		t.Fatalf("expected {1} for empty key")
+	}
+	if tree.Size() != 2 {
+		t.Fatalf("expected size 2, got %d", tree.Size())
+	}
+	checkInvariants(t, tree.root, true)
+}
+
+func TestTree_Insert_sameKeyAddsValues(t *testing.T) {
+	tree := NewTree[int]()
+	k := mm.FromString("key")
+	tree.Insert(k, 1)
+	tree.Insert(k, 2)
+	tree.Insert(k, 2)
+	if tree.Size() != 1 {
+		t.Fatalf("expected size 1, got %d", tree.Size())
+	}
+	if !tree.Get(k).Equals(set3.From(1, 2)) {
+		t.Fatalf("expected {1,2}, got %v", tree.Get(k))
+	}
+}
+
+func TestTree_Insert_clonesKey(t *testing.T) {
+	tree := NewTree[int]()
+	k := mm.Key{1, 2, 3}
+	tree.Insert(k, 1)
+	k[0] = 9
+	if !tree.Contains(mm.Key{1, 2, 3}) {
+		t.Fatalf("stored key was mutated when original key changed")
+	}
+}
+
+func TestTree_Insert_splitsPrefix(t *testing.T) {
+	tree := NewTree[int]()
+	tree.Insert(mm.Key{1, 2, 3, 4}, 1)
+	tree.Insert(mm.Key{1, 2, 5, 6}, 2) // split after [1,2] with two children
+	tree.Insert(mm.Key{1}, 3)          // split after [1] storing the value in the new parent
+
+	for _, tc := range []struct {
+		key  mm.Key
+		want int
+	}{
+		{mm.Key{1, 2, 3, 4}, 1},
+		{mm.Key{1, 2, 5, 6}, 2},
+		{mm.Key{1}, 3},
+	} {
+		if !tree.Get(tc.key).Equals(set3.From(tc.want)) {
+			t.Fatalf("Get(%v) = %v, want {%d}", tc.key, tree.Get(tc.key), tc.want)
+		}
+	}
+	if tree.Contains(mm.Key{1, 2}) {
+		t.Fatalf("inner path node [1,2] must not be reported as key")
+	}
+	if tree.Size() != 3 {
+		t.Fatalf("expected size 3, got %d", tree.Size())
+	}
+	checkInvariants(t, tree.root, true)
+}
+
+func TestTree_Insert_longSharedPrefix(t *testing.T) {
+	tree := NewTree[int]()
+	long := make(mm.Key, 3*maxLocalPrefixLen+5)
+	for i := range long {
+		long[i] = byte(i + 1)
+	}
+	tree.Insert(long, 1)
+	other := long.Clone()
+	other[len(other)-1] = 0xFF
+	tree.Insert(other, 2)
+
+	if !tree.Get(long).Equals(set3.From(1)) || !tree.Get(other).Equals(set3.From(2)) {
+		t.Fatalf("long keys not stored correctly")
+	}
+	inner := *tree.root.findChildSlot(1)
+	if inner.fullPrefixLen() != len(long)-1 || int(inner.GetPrefixLen()) != maxLocalPrefixLen {
+		t.Fatalf("expected one node with a %d byte path, got full=%d inline=%d", len(long)-1, inner.fullPrefixLen(), inner.GetPrefixLen())
+	}
+	if tree.Contains(long[:maxLocalPrefixLen+1]) {
+		t.Fatalf("prefix of a long key must not be reported as key")
+	}
+	if checkInvariants(t, tree.root, true) != 2 {
+		t.Fatalf("expected 2 keys in tree")
+	}
+}
+
+func TestTree_Insert_optimisticLookupVerifiesFullKey(t *testing.T) {
+	tree := NewTree[int]()
+	long := make(mm.Key, 40)
+	for i := range long {
+		long[i] = byte(i + 1)
+	}
+	tree.Insert(long, 1)
+
+	// differs only in a byte that is not stored inline
+	skipped := long.Clone()
+	skipped[maxLocalPrefixLen+5] = 0
+	if tree.Contains(skipped) || tree.Get(skipped).Size() != 0 {
+		t.Fatalf("key differing in a skipped prefix byte must not match")
+	}
+	if tree.Delete(skipped) {
+		t.Fatalf("Delete of key differing in a skipped prefix byte reported success")
+	}
+
+	// inserting it splits the path inside the non-inline part
+	tree.Insert(skipped, 2)
+	if !tree.Get(long).Equals(set3.From(1)) || !tree.Get(skipped).Equals(set3.From(2)) {
+		t.Fatalf("keys sharing more than %d bytes not told apart", maxLocalPrefixLen)
+	}
+	if checkInvariants(t, tree.root, true) != 2 {
+		t.Fatalf("expected 2 keys in tree")
+	}
+
+	// deleting it merges the path again
+	tree.Delete(skipped)
+	merged := *tree.root.findChildSlot(1)
+	if merged.fullPrefixLen() != len(long) || !merged.holdsKey(long) {
+		t.Fatalf("expected path of %d bytes after merge, got %d", len(long), merged.fullPrefixLen())
+	}
+	if !bytes.Equal(merged.loadPrefix(0), long) {
+		t.Fatalf("merged path does not spell the remaining key")
+	}
+	checkInvariants(t, tree.root, true)
+}
+
+func TestTree_Insert_pathsLongerThanMaxPrefixLenAreChained(t *testing.T) {
+	tree := NewTree[int]()
+	long := make(mm.Key, maxPrefixLen+10)
+	for i := range long {
+		long[i] = byte(i)
+	}
+	tree.Insert(long, 1)
+	leaf := *tree.root.findChildSlot(0)
+	if leaf.fullPrefixLen() != maxPrefixLen || leaf.HasValue() || leaf.childCount() != 1 {
+		t.Fatalf("expected value-less leaf with a %d byte path and one child", maxPrefixLen)
+	}
+	if !tree.Get(long).Equals(set3.From(1)) {
+		t.Fatalf("very long key not stored correctly")
+	}
+	if !tree.Delete(long) || tree.root.childCount() != 0 {
+		t.Fatalf("very long key not deleted correctly")
+	}
+}
+
+func TestTree_Insert_promotesThroughAllNodeTypes(t *testing.T) {
+	tree := NewTree[int]()
+	expected := []struct {
+		children int
+		kind     NodeType
+	}{
+		{1, NodeTypeLeaf},
+		{maxChildrenNode64, NodeType64},
+		{maxChildrenNode128, NodeType128},
+		{maxChildrenNode256, NodeType256},
+		{maxChildrenNode512, NodeType512},
+		{maxChildrenNode1024, NodeType1024},
+		{maxChildrenFullNode, FullNodeType},
+	}
+	// insert in descending order so that sorted node types have to shift children
+	inserted := 0
+	for _, e := range expected {
+		for inserted < e.children {
+			tree.Insert(mm.Key{byte(255 - inserted), 0x42}, inserted)
+			inserted++
+		}
+		if tree.root.GetNodeType() != e.kind {
+			t.Fatalf("after %d children root is %v, want %v", inserted, tree.root.GetNodeType(), e.kind)
+		}
+		if tree.root.childCount() != e.children {
+			t.Fatalf("root reports %d children, want %d", tree.root.childCount(), e.children)
+		}
+		checkInvariants(t, tree.root, true)
+	}
+	for i := 0; i < maxChildrenFullNode; i++ {
+		if !tree.Get(mm.Key{byte(255 - i), 0x42}).Equals(set3.From(i)) {
+			t.Fatalf("value for child %d lost during growth", i)
+		}
+	}
+}
+
+func TestTree_Insert_growKeepsValueAndPrefix(t *testing.T) {
+	tree := NewTree[int]()
+	tree.Insert(mm.Key{7, 7}, -1)
+	for i := 0; i < maxChildrenNode1024+1; i++ {
+		tree.Insert(mm.Key{7, 7, byte(i)}, i)
+	}
+	n := tree.root.findChildSlot(7)
+	if n == nil || (*n).GetNodeType() != FullNodeType {
+		t.Fatalf("expected FullNode below root")
+	}
+	if !tree.Get(mm.Key{7, 7}).Equals(set3.From(-1)) {
+		t.Fatalf("value of inner node lost during growth")
+	}
+	checkInvariants(t, tree.root, true)
+}
+
+func TestTree_Insert_randomKeys(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tree := NewTree[int]()
+	reference := map[string]*set3.Set3[int]{}
+	for i := 0; i < 5000; i++ {
+		k := make(mm.Key, rng.Intn(20))
+		for j := range k {
+			k[j] = byte(rng.Intn(8)) // small alphabet -> many shared prefixes
+		}
+		tree.Insert(k, i)
+		if reference[string(k)] == nil {
+			reference[string(k)] = set3.Empty[int]()
+		}
+		reference[string(k)].Add(i)
+	}
+	if tree.Size() != uint64(len(reference)) {
+		t.Fatalf("size = %d, want %d", tree.Size(), len(reference))
+	}
+	if checkInvariants(t, tree.root, true) != tree.Size() {
+		t.Fatalf("number of value nodes does not match size")
+	}
+	for k, want := range reference {
+		if !tree.Get(mm.Key(k)).Equals(want) {
+			t.Fatalf("Get(%v) returned unexpected set", mm.Key(k))
+		}
+	}
+}
@@ -0,0 +1,701 @@
+package art
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"iter"
+	"math/bits"
+	"os"
+	"sync"
+
+	set3 "github.com/TomTonic/Set3"
+	mm "github.com/TomTonic/multimap"
+)
+
+// Mapped snapshot format
+// ----------------------
+// A mapped snapshot is a flat, immutable copy of a Tree that can be queried
+// straight from a memory-mapped file. Nodes are stored with the same layout
+// as the node structs in node_types.go, with file offsets (uint64, little
+// endian) in place of pointers and 0 in place of nil. All nodes start at
+// 8-byte aligned offsets.
+//
+//	header   64 bytes: magic "MART", version (uint32), root offset, number of
+//	         keys, file size (uint64 each), CRC-32C of everything after the
+//	         header and CRC-32C of the preceding header bytes (uint32 each)
+//	nodes    children are written before their parent, so every child offset
+//	         is smaller than the offset of its parent and the root comes last
+//	values   written right before their node: key length and number of
+//	         values (uint32 each), the full key, then every value as unsigned
+//	         varint length and the bytes of the ValueCodec
+//
+// Since the file is never modified, every node uses the smallest node type
+// its children fit into and firstKeyByte[] is sorted for all node types.
+// A FullNode stores the offset of its external array of 256 child offsets.
+const (
+	mappedMagic      = "MART"
+	mappedVersion    = 1
+	mappedHeaderSize = 64
+	mappedCRCOffset  = 32 // body CRC, followed by the header CRC
+
+	// offsets within the common node header, see Node
+	mappedNumChildren = 1
+	mappedPrefixLen   = 2
+	mappedPrefix      = 4
+	mappedValue       = 16
+)
+
+// mappedLayout describes where a node type keeps its fields. The offsets are
+// those of the node structs on 64-bit platforms.
+type mappedLayout struct {
+	size        int
+	bitmap      int // offset of the presence bitmap, 0 if there is none
+	keys        int // offset of firstKeyByte[], 0 if there is none
+	child       int // offset of the child offsets (FullNode: of the array offset)
+	maxChildren int
+}
+
+var mappedLayouts = [...]mappedLayout{
+	NodeTypeLeaf: {size: 32, child: 24, maxChildren: maxChildrenLeaf},
+	NodeType64:   {size: 64, keys: 24, child: 32, maxChildren: maxChildrenNode64},
+	NodeType128:  {size: 128, keys: 24, child: 40, maxChildren: maxChildrenNode128},
+	NodeType256:  {size: 256, keys: 24, child: 56, maxChildren: maxChildrenNode256},
+	NodeType512:  {size: 512, bitmap: 24, keys: 56, child: 112, maxChildren: maxChildrenNode512},
+	NodeType1024: {size: 1024, bitmap: 24, keys: 56, child: 168, maxChildren: maxChildrenNode1024},
+	FullNodeType: {size: 64, bitmap: 24, child: 56, maxChildren: maxChildrenFullNode},
+}
+
+var mappedCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrMappedFormat is returned by OpenMapped and MappedTree.Verify for files
+// that are not valid mapped snapshots.
+var ErrMappedFormat = errors.New("art: invalid mapped snapshot")
+
+// WriteMapped writes all keys and values of m to a mapped snapshot file at
+// path, encoding values with codec. The file is written under a temporary
+// name and renamed when complete, so readers never open a partial snapshot.
+// If m was created by NewART, its tree is written directly while holding the
+// read lock; any other MultiMap is copied into a Tree first.
+func WriteMapped[T comparable](path string, m mm.MultiMap[T], codec mm.ValueCodec[T]) error {
+	if a, ok := m.(*artMultiMap[T]); ok {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		return writeMappedTree(path, a.tree, codec)
+	}
+	tree := NewTree[T]()
+	for k, values := range m.All() {
+		for v := range values.ImmutableRange() {
+			tree.Insert(k, v)
+		}
+	}
+	return writeMappedTree(path, tree, codec)
+}
+
+// writeMappedTree writes t to path as described for WriteMapped.
+func writeMappedTree[T comparable](path string, t *Tree[T], codec mm.ValueCodec[T]) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	mw := &mappedWriter[T]{w: bufio.NewWriter(f), crc: crc32.New(mappedCRCTable), off: mappedHeaderSize, codec: codec}
+	// the header is written last, once root offset and checksum are known
+	_, err = f.Write(make([]byte, mappedHeaderSize))
+	var root uint64
+	if err == nil {
+		root, err = mw.writeNode(t.root)
+	}
+	if err == nil {
+		err = mw.w.Flush()
+	}
+	if err == nil {
+		header := make([]byte, mappedHeaderSize)
+		copy(header, mappedMagic)
+		binary.LittleEndian.PutUint32(header[4:], mappedVersion)
+		binary.LittleEndian.PutUint64(header[8:], root)
+		binary.LittleEndian.PutUint64(header[16:], t.Size())
+		binary.LittleEndian.PutUint64(header[24:], mw.off)
+		binary.LittleEndian.PutUint32(header[mappedCRCOffset:], mw.crc.Sum32())
+		binary.LittleEndian.PutUint32(header[mappedCRCOffset+4:], crc32.Checksum(header[:mappedCRCOffset+4], mappedCRCTable))
+		_, err = f.WriteAt(header, 0)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// mappedWriter appends nodes and values to a mapped snapshot.
+type mappedWriter[T comparable] struct {
+	w     *bufio.Writer
+	crc   hash.Hash32
+	off   uint64 // offset of the next byte written
+	codec mm.ValueCodec[T]
+	err   error
+}
+
+// write appends p. After the first error, writes are skipped.
+func (mw *mappedWriter[T]) write(p []byte) {
+	if mw.err != nil {
+		return
+	}
+	mw.crc.Write(p)
+	_, mw.err = mw.w.Write(p)
+	mw.off += uint64(len(p))
+}
+
+// align pads the file to the next 8-byte boundary.
+func (mw *mappedWriter[T]) align() {
+	if pad := -mw.off & 7; pad != 0 {
+		mw.write(make([]byte, pad))
+	}
+}
+
+// writeNode writes the subtree rooted at n, children first, and returns the
+// offset of n.
+func (mw *mappedWriter[T]) writeNode(n *Node[T]) (uint64, error) {
+	var keys []byte
+	var children []uint64
+	var err error
+	n.forEachChildAscending(func(c *Node[T]) bool {
+		var off uint64
+		off, err = mw.writeNode(c)
+		// a child's compressed path starts with the byte it is indexed by
+		keys = append(keys, c.localPrefix[0])
+		children = append(children, off)
+		return err == nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var valueOff uint64
+	if n.HasValue() {
+		if valueOff, err = mw.writeValues(n.value); err != nil {
+			return 0, err
+		}
+	}
+	nt := mappedNodeType(len(children))
+	layout := mappedLayouts[nt]
+	rec := make([]byte, layout.size)
+	rec[0] = uint8(nt)<<4 | n.GetPrefixLen()
+	binary.LittleEndian.PutUint16(rec[mappedPrefixLen:], n.prefixLen)
+	copy(rec[mappedPrefix:mappedValue], n.localPrefix[:])
+	binary.LittleEndian.PutUint64(rec[mappedValue:], valueOff)
+	if layout.bitmap != 0 {
+		var bitmap PresenceBitmap
+		for _, b := range keys {
+			bitmap.Set(b)
+		}
+		for i, word := range bitmap {
+			binary.LittleEndian.PutUint64(rec[layout.bitmap+8*i:], word)
+		}
+	}
+	if nt == FullNodeType {
+		// like in memory, the 256 child slots live in an external array and
+		// the child count is tracked in the bitmap only, see childCount
+		array := make([]byte, 8*maxChildrenFullNode)
+		for i, b := range keys {
+			binary.LittleEndian.PutUint64(array[8*int(b):], children[i])
+		}
+		mw.align()
+		binary.LittleEndian.PutUint64(rec[layout.child:], mw.off)
+		mw.write(array)
+	} else {
+		rec[mappedNumChildren] = uint8(len(children))
+		if layout.keys != 0 {
+			copy(rec[layout.keys:], keys)
+		}
+		for i, c := range children {
+			binary.LittleEndian.PutUint64(rec[layout.child+8*i:], c)
+		}
+	}
+	mw.align()
+	off := mw.off
+	mw.write(rec)
+	return off, mw.err
+}
+
+// writeValues writes the full key and the values of a node and returns the
+// offset of the record.
+func (mw *mappedWriter[T]) writeValues(v *valueSet[T]) (uint64, error) {
+	rec := binary.LittleEndian.AppendUint32(nil, uint32(len(v.key)))
+	rec = binary.LittleEndian.AppendUint32(rec, v.Size())
+	rec = append(rec, v.key...)
+	for value := range v.ImmutableRange() {
+		p, err := mw.codec.EncodeValue(value)
+		if err != nil {
+			return 0, err
+		}
+		rec = binary.AppendUvarint(rec, uint64(len(p)))
+		rec = append(rec, p...)
+	}
+	mw.align()
+	off := mw.off
+	mw.write(rec)
+	return off, mw.err
+}
+
+// mappedNodeType returns the smallest node type with room for count children.
+func mappedNodeType(count int) NodeType {
+	for nt, layout := range mappedLayouts {
+		if count <= layout.maxChildren {
+			return NodeType(nt)
+		}
+	}
+	return FullNodeType
+}
+
+// MappedTree serves queries from a mapped snapshot written by WriteMapped.
+// The file is memory-mapped read-only where the platform supports it, so
+// opening it costs next to nothing and several processes share its pages in
+// the page cache; elsewhere it is read into memory. Keys are looked up and
+// walked in place; only the values of the keys a query returns are decoded.
+//
+// A MappedTree is immutable and safe for concurrent use, but must not be used
+// after Close. OpenMapped only checks the header; use Verify to check the
+// whole file. A query that runs into damage the header check cannot see
+// stops there and returns what it found so far, and Err reports the damage.
+type MappedTree[T comparable] struct {
+	data  []byte
+	root  uint64
+	size  uint64
+	codec mm.ValueCodec[T]
+	unmap func() error
+
+	mu  sync.Mutex
+	err error
+}
+
+// OpenMapped opens the mapped snapshot at path and decodes values with codec.
+func OpenMapped[T comparable](path string, codec mm.ValueCodec[T]) (*MappedTree[T], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < mappedHeaderSize {
+		return nil, ErrMappedFormat
+	}
+	data, unmap, err := mapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+	m := &MappedTree[T]{data: data, codec: codec, unmap: unmap}
+	if err := m.checkHeader(); err != nil {
+		unmap()
+		return nil, err
+	}
+	return m, nil
+}
+
+// checkHeader validates the header and reads root offset and size.
+func (m *MappedTree[T]) checkHeader() error {
+	h := m.data[:mappedHeaderSize]
+	if string(h[:4]) != mappedMagic ||
+		binary.LittleEndian.Uint32(h[mappedCRCOffset+4:]) != crc32.Checksum(h[:mappedCRCOffset+4], mappedCRCTable) {
+		return ErrMappedFormat
+	}
+	if v := binary.LittleEndian.Uint32(h[4:]); v != mappedVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrMappedFormat, v)
+	}
+	m.root = binary.LittleEndian.Uint64(h[8:])
+	m.size = binary.LittleEndian.Uint64(h[16:])
+	if binary.LittleEndian.Uint64(h[24:]) != uint64(len(m.data)) || m.root < mappedHeaderSize || m.root >= uint64(len(m.data)) {
+		return ErrMappedFormat
+	}
+	return nil
+}
+
+// Verify checks the checksum of the whole file. It reads every page, so it
+// takes away the startup advantage of mapping the file; call it when a file
+// is first received rather than on every open.
+func (m *MappedTree[T]) Verify() error {
+	want := binary.LittleEndian.Uint32(m.data[mappedCRCOffset:])
+	if crc32.Checksum(m.data[mappedHeaderSize:], mappedCRCTable) != want {
+		return ErrMappedFormat
+	}
+	return nil
+}
+
+// Err returns the error the first query that ran into a damaged part of the
+// file stopped with, wrapping ErrMappedFormat, or nil.
+func (m *MappedTree[T]) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// mappedDamage is the panic value of fail. It unwinds a query from wherever
+// the damage is found to the deferred recoverDamage of its entry point.
+type mappedDamage struct{ err error }
+
+// fail aborts the current query because the file is damaged.
+func (m *MappedTree[T]) fail(err error) {
+	panic(mappedDamage{err})
+}
+
+// recoverDamage stops a panic raised by fail and keeps its error for Err.
+// Every query entry point defers it; other panics are passed on.
+func (m *MappedTree[T]) recoverDamage() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	d, ok := r.(mappedDamage)
+	if !ok {
+		panic(r)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err == nil {
+		m.err = d.err
+	}
+}
+
+// span returns the n bytes of the file at off.
+func (m *MappedTree[T]) span(off, n uint64) []byte {
+	if off > uint64(len(m.data)) || n > uint64(len(m.data))-off {
+		m.fail(fmt.Errorf("%w: %d bytes at offset %d are past the end of the file", ErrMappedFormat, n, off))
+	}
+	return m.data[off : off+n]
+}
+
+// Close unmaps the file. The MappedTree must not be used afterwards.
+func (m *MappedTree[T]) Close() error {
+	if m.unmap == nil {
+		return nil
+	}
+	err := m.unmap()
+	m.data, m.unmap = nil, nil
+	return err
+}
+
+// NumberOfKeys returns the number of keys in the snapshot.
+func (m *MappedTree[T]) NumberOfKeys() uint64 { return m.size }
+
+// ContainsKey reports whether key is in the snapshot.
+func (m *MappedTree[T]) ContainsKey(key mm.Key) (found bool) {
+	defer m.recoverDamage()
+	_, found = m.lookup(key)
+	return found
+}
+
+// ValuesFor returns the values stored at key, or an empty set if key is not
+// in the snapshot. The result is never nil.
+func (m *MappedTree[T]) ValuesFor(key mm.Key) (values *set3.Set3[T]) {
+	values = set3.Empty[T]()
+	defer m.recoverDamage()
+	if n, found := m.lookup(key); found {
+		m.addValues(values, n)
+	}
+	return values
+}
+
+// ValuesBetweenInclusive returns all values whose keys are between from and
+// to, including both, see mm.MultiMap.ValuesBetweenInclusive.
+func (m *MappedTree[T]) ValuesBetweenInclusive(from, to mm.Key) *set3.Set3[T] {
+	return m.valuesIn(keyRange{from: from, to: to, hasFrom: true, hasTo: true, fromIncl: true, toIncl: true})
+}
+
+// ValuesBetweenExclusive returns all values whose keys are between from and
+// to, excluding both.
+func (m *MappedTree[T]) ValuesBetweenExclusive(from, to mm.Key) *set3.Set3[T] {
+	return m.valuesIn(keyRange{from: from, to: to, hasFrom: true, hasTo: true})
+}
+
+// ValuesFromInclusive returns all values whose keys are greater than or equal
+// to from.
+func (m *MappedTree[T]) ValuesFromInclusive(from mm.Key) *set3.Set3[T] {
+	return m.valuesIn(keyRange{from: from, hasFrom: true, fromIncl: true})
+}
+
+// ValuesFromExclusive returns all values whose keys are greater than from.
+func (m *MappedTree[T]) ValuesFromExclusive(from mm.Key) *set3.Set3[T] {
+	return m.valuesIn(keyRange{from: from, hasFrom: true})
+}
+
+// ValuesToInclusive returns all values whose keys are less than or equal to
+// to.
+func (m *MappedTree[T]) ValuesToInclusive(to mm.Key) *set3.Set3[T] {
+	return m.valuesIn(keyRange{to: to, hasTo: true, toIncl: true})
+}
+
+// ValuesToExclusive returns all values whose keys are less than to.
+func (m *MappedTree[T]) ValuesToExclusive(to mm.Key) *set3.Set3[T] {
+	return m.valuesIn(keyRange{to: to, hasTo: true})
+}
+
+// ValuesWithPrefix returns all values whose keys start with prefix.
+func (m *MappedTree[T]) ValuesWithPrefix(prefix mm.Key) *set3.Set3[T] {
+	return m.valuesIn(prefixRange(prefix))
+}
+
+// AllValues returns all values in the snapshot.
+func (m *MappedTree[T]) AllValues() *set3.Set3[T] { return m.valuesIn(keyRange{}) }
+
+// valuesIn returns the union of the values of all keys in r.
+func (m *MappedTree[T]) valuesIn(r keyRange) (result *set3.Set3[T]) {
+	result = set3.Empty[T]()
+	defer m.recoverDamage()
+	m.walkRange(r, func(_ mm.Key, n mappedNode) bool {
+		m.addValues(result, n)
+		return true
+	})
+	return result
+}
+
+// All returns an iterator over all keys and their values in ascending order.
+// Yielded keys and sets are independent copies.
+func (m *MappedTree[T]) All() iter.Seq2[mm.Key, *set3.Set3[T]] {
+	return m.entriesIn(keyRange{})
+}
+
+// Range returns an iterator over all keys between from and to and their
+// values in ascending order, see mm.MultiMap.Range.
+func (m *MappedTree[T]) Range(from, to mm.Key, inclusive bool) iter.Seq2[mm.Key, *set3.Set3[T]] {
+	return m.entriesIn(keyRange{from: from, to: to, hasFrom: true, hasTo: true, fromIncl: inclusive, toIncl: inclusive})
+}
+
+// Keys returns an iterator over all keys in ascending order. Yielded keys
+// are clones.
+func (m *MappedTree[T]) Keys() iter.Seq[mm.Key] {
+	return func(yield func(mm.Key) bool) {
+		defer m.recoverDamage()
+		m.walkRange(keyRange{}, func(k mm.Key, _ mappedNode) bool {
+			return yield(k.Clone())
+		})
+	}
+}
+
+// entriesIn returns an iterator over the keys in r and their values.
+func (m *MappedTree[T]) entriesIn(r keyRange) iter.Seq2[mm.Key, *set3.Set3[T]] {
+	return func(yield func(mm.Key, *set3.Set3[T]) bool) {
+		defer m.recoverDamage()
+		m.walkRange(r, func(k mm.Key, n mappedNode) bool {
+			return yield(k.Clone(), m.values(n))
+		})
+	}
+}
+
+// mappedNode is a node record in the file together with its offset.
+type mappedNode struct {
+	rec []byte
+	off uint64
+}
+
+// node returns the node record at off. Child offsets must be smaller than
+// the offset of their parent, which rules out cycles in damaged files.
+func (m *MappedTree[T]) node(off, parent uint64) mappedNode {
+	if off < mappedHeaderSize || off >= parent {
+		m.fail(fmt.Errorf("%w: node at offset %d has invalid child offset %d", ErrMappedFormat, parent, off))
+	}
+	nt := NodeType(m.span(off, 1)[0] >> 4)
+	if int(nt) >= len(mappedLayouts) {
+		m.fail(fmt.Errorf("%w: invalid node type %d at offset %d", ErrMappedFormat, nt, off))
+	}
+	n := mappedNode{rec: m.span(off, uint64(mappedLayouts[nt].size)), off: off}
+	if nt != FullNodeType && int(n.rec[mappedNumChildren]) > mappedLayouts[nt].maxChildren {
+		m.fail(fmt.Errorf("%w: node at offset %d has too many children", ErrMappedFormat, off))
+	}
+	return n
+}
+
+func (n mappedNode) nodeType() NodeType { return NodeType(n.rec[0] >> 4) }
+
+func (n mappedNode) inlinePrefix() []byte {
+	return n.rec[mappedPrefix : mappedPrefix+int(n.rec[0]&0x0F)]
+}
+
+func (n mappedNode) prefixLen() int {
+	return int(binary.LittleEndian.Uint16(n.rec[mappedPrefixLen:]))
+}
+
+func (n mappedNode) valueOffset() uint64 { return binary.LittleEndian.Uint64(n.rec[mappedValue:]) }
+
+// key returns the full key stored with the values of n, a slice of the file.
+func (m *MappedTree[T]) key(n mappedNode) mm.Key {
+	off := n.valueOffset()
+	keyLen := uint64(binary.LittleEndian.Uint32(m.span(off, 8)))
+	return m.span(off+8, keyLen)
+}
+
+// values decodes the values of n into a new set.
+func (m *MappedTree[T]) values(n mappedNode) *set3.Set3[T] {
+	result := set3.Empty[T]()
+	m.addValues(result, n)
+	return result
+}
+
+// addValues decodes the values of n into result. A value the codec rejects
+// means the file is damaged.
+func (m *MappedTree[T]) addValues(result *set3.Set3[T], n mappedNode) {
+	off := n.valueOffset()
+	header := m.span(off, 8)
+	keyLen := uint64(binary.LittleEndian.Uint32(header))
+	count := binary.LittleEndian.Uint32(header[4:])
+	m.span(off+8, keyLen)
+	p := m.data[off+8+keyLen:]
+	for range count {
+		l, size := binary.Uvarint(p)
+		if size <= 0 || l > uint64(len(p)-size) {
+			m.fail(fmt.Errorf("%w: values at offset %d are truncated", ErrMappedFormat, off))
+		}
+		v, err := m.codec.DecodeValue(p[size : size+int(l)])
+		if err != nil {
+			m.fail(fmt.Errorf("%w: values at offset %d: %w", ErrMappedFormat, off, err))
+		}
+		result.Add(v)
+		p = p[size+int(l):]
+	}
+}
+
+// findChild returns the child of n indexed by b.
+func (m *MappedTree[T]) findChild(n mappedNode, b byte) (mappedNode, bool) {
+	layout := mappedLayouts[n.nodeType()]
+	if layout.bitmap != 0 && n.rec[layout.bitmap+int(b>>6)*8+int(b&0x3F)/8]&(1<<(b&7)) == 0 {
+		// the bitmap rejects absent bytes without touching firstKeyByte[]
+		return mappedNode{}, false
+	}
+	switch n.nodeType() {
+	case NodeTypeLeaf:
+		if n.rec[mappedNumChildren] == 0 {
+			return mappedNode{}, false
+		}
+		c := m.node(binary.LittleEndian.Uint64(n.rec[layout.child:]), n.off)
+		inline := c.inlinePrefix()
+		return c, len(inline) > 0 && inline[0] == b
+	case FullNodeType:
+		array := m.fullNodeArray(n)
+		return m.node(binary.LittleEndian.Uint64(array[8*int(b):]), n.off), true
+	}
+	// firstKeyByte[] is sorted, but for at most 107 bytes IndexByte beats a
+	// binary search
+	i := bytes.IndexByte(n.rec[layout.keys:layout.keys+int(n.rec[mappedNumChildren])], b)
+	if i < 0 {
+		return mappedNode{}, false
+	}
+	return m.node(binary.LittleEndian.Uint64(n.rec[layout.child+8*i:]), n.off), true
+}
+
+// forEachChild calls f for every child of n in ascending order of the key
+// bytes until f returns false. It reports whether all calls returned true.
+func (m *MappedTree[T]) forEachChild(n mappedNode, f func(c mappedNode) bool) bool {
+	layout := mappedLayouts[n.nodeType()]
+	if n.nodeType() == FullNodeType {
+		array := m.fullNodeArray(n)
+		for w := 0; w < 4; w++ {
+			for word := binary.LittleEndian.Uint64(n.rec[layout.bitmap+8*w:]); word != 0; word &= word - 1 {
+				b := w<<6 | bits.TrailingZeros64(word)
+				if !f(m.node(binary.LittleEndian.Uint64(array[8*b:]), n.off)) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	for i := 0; i < int(n.rec[mappedNumChildren]); i++ {
+		if !f(m.node(binary.LittleEndian.Uint64(n.rec[layout.child+8*i:]), n.off)) {
+			return false
+		}
+	}
+	return true
+}
+
+// fullNodeArray returns the external array of child offsets of the FullNode n.
+func (m *MappedTree[T]) fullNodeArray(n mappedNode) []byte {
+	off := binary.LittleEndian.Uint64(n.rec[mappedLayouts[FullNodeType].child:])
+	return m.span(off, 8*maxChildrenFullNode)
+}
+
+// lookup returns the node holding key. Like Tree.Get, it compares only the
+// inline part of compressed paths and verifies the full key at the end.
+func (m *MappedTree[T]) lookup(key mm.Key) (mappedNode, bool) {
+	n := m.node(m.root, uint64(len(m.data)))
+	depth := 0
+	for {
+		inline := n.inlinePrefix()
+		if depth+n.prefixLen() > len(key) || !bytes.HasPrefix(key[depth:], inline) {
+			return mappedNode{}, false
+		}
+		depth += n.prefixLen()
+		if depth == len(key) {
+			return n, n.valueOffset() != 0 && m.key(n).Equal(key)
+		}
+		var found bool
+		if n, found = m.findChild(n, key[depth]); !found {
+			return mappedNode{}, false
+		}
+	}
+}
+
+// walkRange calls f in ascending key order for every key in r together with
+// the node holding its values, until f returns false. The key passed to f is
+// a slice of the file and must not be modified.
+func (m *MappedTree[T]) walkRange(r keyRange, f func(key mm.Key, n mappedNode) bool) {
+	root := m.node(m.root, uint64(len(m.data)))
+	m.walkNode(root, make([]byte, 0, 32), &r, !r.hasFrom, !r.hasTo, f)
+}
+
+// walkNode is the mapped counterpart of Node.walkRange.
+func (m *MappedTree[T]) walkNode(n mappedNode, path []byte, r *keyRange, lowerDone, upperDone bool, f func(key mm.Key, n mappedNode) bool) bool {
+	if full := n.prefixLen(); full <= maxLocalPrefixLen {
+		path = append(path, n.inlinePrefix()...)
+	} else {
+		depth := len(path)
+		key := m.anyKey(n)
+		if depth+full > len(key) {
+			m.fail(fmt.Errorf("%w: node at offset %d has a prefix longer than its keys", ErrMappedFormat, n.off))
+		}
+		path = append(path, key[depth:depth+full]...)
+	}
+	s := r.enterAscending(path, lowerDone, upperDone)
+	if s.skip || s.stop {
+		return !s.stop
+	}
+	if s.visitSelf && n.valueOffset() != 0 && !f(m.key(n), n) {
+		return false
+	}
+	if !s.descend {
+		// the node was the last one in range
+		return false
+	}
+	return m.forEachChild(n, func(c mappedNode) bool {
+		return m.walkNode(c, path, r, s.lowerDone, s.upperDone, f)
+	})
+}
+
+// anyKey returns the full key of n or of any node with a value below n, see
+// Node.anyKey.
+func (m *MappedTree[T]) anyKey(n mappedNode) mm.Key {
+	for n.valueOffset() == 0 {
+		var next mappedNode
+		m.forEachChild(n, func(c mappedNode) bool {
+			next = c
+			return false
+		})
+		if next.rec == nil {
+			return nil
+		}
+		n = next
+	}
+	return m.key(n)
+}
@@ -0,0 +1,237 @@
+package art
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"unsafe"
+
+	mm "github.com/TomTonic/multimap"
+)
+
+func TestMappedLayoutsMatchNodeStructs(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("the node structs have the mapped layout on 64-bit platforms only")
+	}
+	var (
+		leaf LeafNode[int]
+		n64  Node64[int]
+		n128 Node128[int]
+		n256 Node256[int]
+		n512 Node512[int]
+		n1k  Node1024[int]
+		full FullNode[int]
+	)
+	got := []mappedLayout{
+		{int(unsafe.Sizeof(leaf)), 0, 0, int(unsafe.Offsetof(leaf.child)), maxChildrenLeaf},
+		{int(unsafe.Sizeof(n64)), 0, int(unsafe.Offsetof(n64.firstKeyByte)), int(unsafe.Offsetof(n64.child)), maxChildrenNode64},
+		{int(unsafe.Sizeof(n128)), 0, int(unsafe.Offsetof(n128.firstKeyByte)), int(unsafe.Offsetof(n128.child)), maxChildrenNode128},
+		{int(unsafe.Sizeof(n256)), 0, int(unsafe.Offsetof(n256.firstKeyByte)), int(unsafe.Offsetof(n256.child)), maxChildrenNode256},
+		{int(unsafe.Sizeof(n512)), int(unsafe.Offsetof(n512.bitmap)), int(unsafe.Offsetof(n512.firstKeyByte)), int(unsafe.Offsetof(n512.child)), maxChildrenNode512},
+		{int(unsafe.Sizeof(n1k)), int(unsafe.Offsetof(n1k.bitmap)), int(unsafe.Offsetof(n1k.firstKeyByte)), int(unsafe.Offsetof(n1k.child)), maxChildrenNode1024},
+		{int(unsafe.Sizeof(full)), int(unsafe.Offsetof(full.bitmap)), 0, int(unsafe.Offsetof(full.child)), maxChildrenFullNode},
+	}
+	if !slices.Equal(got, mappedLayouts[:]) {
+		t.Fatalf("mapped layouts %v differ from the node structs %v", mappedLayouts, got)
+	}
+	if unsafe.Offsetof(leaf.value) != mappedValue || unsafe.Offsetof(leaf.prefixLen) != mappedPrefixLen {
+		t.Fatalf("mapped node header differs from Node")
+	}
+}
+
+// writeAndOpenMapped writes m to a mapped snapshot in a temporary directory
+// and opens it.
+func writeAndOpenMapped(t *testing.T, m mm.MultiMap[int]) *MappedTree[int] {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "index.art")
+	if err := WriteMapped(path, m, mm.IntCodec[int]{}); err != nil {
+		t.Fatalf("WriteMapped: %v", err)
+	}
+	mt, err := OpenMapped(path, mm.IntCodec[int]{})
+	if err != nil {
+		t.Fatalf("OpenMapped: %v", err)
+	}
+	t.Cleanup(func() { mt.Close() })
+	if err := mt.Verify(); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	return mt
+}
+
+func TestMapped_matchesART(t *testing.T) {
+	rng := rand.New(rand.NewSource(21))
+	m := NewART[int]()
+	// short keys fill nodes of every type up to FullNode, long keys with a
+	// shared head exercise compressed paths beyond the inline prefix
+	var keys []mm.Key
+	for i := 0; i < 3000; i++ {
+		var k mm.Key
+		switch rng.Intn(3) {
+		case 0:
+			k = mm.Key{byte(rng.Intn(256)), byte(rng.Intn(200))}
+		case 1:
+			k = append(mm.FromString("a-long-shared-key-head/"), byte(rng.Intn(40)))
+		default:
+			k = make(mm.Key, rng.Intn(5))
+			rng.Read(k)
+		}
+		keys = append(keys, k)
+		m.AddValue(k, rng.Intn(1000)-500)
+	}
+	mt := writeAndOpenMapped(t, m)
+
+	if mt.NumberOfKeys() != m.NumberOfKeys() {
+		t.Fatalf("NumberOfKeys() = %d, want %d", mt.NumberOfKeys(), m.NumberOfKeys())
+	}
+	if got := slices.Collect(mt.Keys()); !slices.EqualFunc(got, m.AllKeys(), mm.Key.Equal) {
+		t.Fatalf("Keys() differ from AllKeys() of the source map")
+	}
+	for i := 0; i < 2000; i++ {
+		k := keys[rng.Intn(len(keys))]
+		if rng.Intn(2) == 0 {
+			k = append(k.Clone(), byte(rng.Intn(256)))
+		}
+		if mt.ContainsKey(k) != m.ContainsKey(k) || !mt.ValuesFor(k).Equals(m.ValuesFor(k)) {
+			t.Fatalf("ValuesFor(%v) differs", k)
+		}
+		from, to := keys[rng.Intn(len(keys))], keys[rng.Intn(len(keys))]
+		if !mt.ValuesBetweenInclusive(from, to).Equals(m.ValuesBetweenInclusive(from, to)) ||
+			!mt.ValuesBetweenExclusive(from, to).Equals(m.ValuesBetweenExclusive(from, to)) ||
+			!mt.ValuesFromExclusive(from).Equals(m.ValuesFromExclusive(from)) ||
+			!mt.ValuesToInclusive(to).Equals(m.ValuesToInclusive(to)) ||
+			!mt.ValuesWithPrefix(k[:len(k)/2]).Equals(m.ValuesWithPrefix(k[:len(k)/2])) {
+			t.Fatalf("range queries between %v and %v differ", from, to)
+		}
+	}
+	var got, want []mm.Key
+	for k, values := range mt.Range(keys[0], keys[1], true) {
+		got = append(got, k)
+		if !values.Equals(m.ValuesFor(k)) {
+			t.Fatalf("Range yielded wrong values for %v", k)
+		}
+	}
+	for k := range m.Range(keys[0], keys[1], true) {
+		want = append(want, k)
+	}
+	if !slices.EqualFunc(got, want, mm.Key.Equal) {
+		t.Fatalf("Range() yielded %d keys, want %d", len(got), len(want))
+	}
+}
+
+func TestMapped_emptyAndArrayBasedSource(t *testing.T) {
+	mt := writeAndOpenMapped(t, mm.NewArrayBased[int]())
+	if mt.NumberOfKeys() != 0 || mt.AllValues().Size() != 0 || mt.ContainsKey(mm.Key{}) {
+		t.Fatalf("snapshot of an empty map should be empty")
+	}
+
+	m := mm.NewArrayBased[int]()
+	m.AddValue(mm.Key{}, 1)
+	m.AddValue(mm.FromString("x"), 2)
+	mt = writeAndOpenMapped(t, m)
+	if !mt.ValuesFor(mm.Key{}).Equals(m.ValuesFor(mm.Key{})) || mt.AllValues().Size() != 2 {
+		t.Fatalf("snapshot of an array-based map differs")
+	}
+}
+
+func TestMapped_rejectsDamagedFiles(t *testing.T) {
+	m := NewART[int]()
+	for i := range 100 {
+		m.AddValue(mm.FromInt(i), i)
+	}
+	path := filepath.Join(t.TempDir(), "index.art")
+	if err := WriteMapped(path, m, mm.IntCodec[int]{}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+
+	damage := func(name string, mutate func([]byte) []byte) error {
+		p := filepath.Join(t.TempDir(), name)
+		os.WriteFile(p, mutate(slices.Clone(data)), 0o644)
+		mt, err := OpenMapped(p, mm.IntCodec[int]{})
+		if err == nil {
+			err = mt.Verify()
+			mt.Close()
+		}
+		return err
+	}
+	cases := map[string]func([]byte) []byte{
+		"magic":     func(b []byte) []byte { b[0] = 'X'; return b },
+		"root":      func(b []byte) []byte { b[8]++; return b },
+		"truncated": func(b []byte) []byte { return b[:len(b)-8] },
+		"body":      func(b []byte) []byte { b[len(b)/2] ^= 1; return b },
+		"short":     func(b []byte) []byte { return b[:10] },
+	}
+	for name, mutate := range cases {
+		if err := damage(name, mutate); !errors.Is(err, ErrMappedFormat) {
+			t.Fatalf("%s: expected ErrMappedFormat, got %v", name, err)
+		}
+	}
+}
+
+func TestMapped_queriesOnDamagedBody(t *testing.T) {
+	m := NewART[int]()
+	for i := range 300 {
+		m.AddValue(mm.FromInt(i*7), i)
+	}
+	// long shared prefixes and a node with more children than a Node1024
+	// holds
+	for i := range 256 {
+		m.AddValue(mm.Key(append([]byte("a long shared prefix "), byte(i))), 1000+i)
+	}
+	path := filepath.Join(t.TempDir(), "index.art")
+	if err := WriteMapped(path, m, mm.IntCodec[int]{}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+
+	// open reads the header of data without checking the body, like
+	// OpenMapped without Verify
+	open := func(data []byte) *MappedTree[int] {
+		mt := &MappedTree[int]{data: data, codec: mm.IntCodec[int]{}}
+		if err := mt.checkHeader(); err != nil {
+			t.Fatal(err)
+		}
+		return mt
+	}
+	query := func(mt *MappedTree[int]) {
+		mt.AllValues()
+		mt.ValuesFor(mm.FromInt(70))
+		mt.ContainsKey(mm.Key("a long shared prefix x"))
+		mt.ValuesWithPrefix(mm.Key("a long"))
+		for range mt.All() {
+		}
+		for range mt.Keys() {
+		}
+	}
+
+	// the root record is the last one written
+	root := open(data).root
+	for name, mutate := range map[string]func([]byte){
+		"value offset": func(b []byte) { binary.LittleEndian.PutUint64(b[root+mappedValue:], math.MaxUint64) },
+		"child count":  func(b []byte) { b[root+mappedNumChildren] = 255 },
+		"node type":    func(b []byte) { b[root] |= 0xF0 },
+	} {
+		damaged := slices.Clone(data)
+		mutate(damaged)
+		mt := open(damaged)
+		query(mt)
+		if err := mt.Err(); !errors.Is(err, ErrMappedFormat) {
+			t.Fatalf("%s: expected ErrMappedFormat, got %v", name, err)
+		}
+	}
+
+	// damage anywhere in the body must never make a query panic
+	for off := mappedHeaderSize; off < len(data); off += 5 {
+		damaged := slices.Clone(data)
+		damaged[off] ^= 0xA5
+		query(open(damaged))
+	}
+	if mt := open(data); mt.AllValues().Size() != 556 || mt.Err() != nil {
+		t.Fatalf("intact snapshot: %d values, %v", mt.AllValues().Size(), mt.Err())
+	}
+}
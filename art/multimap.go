@@ -0,0 +1,381 @@
+package art
+
+import (
+	"iter"
+	"sync"
+
+	set3 "github.com/TomTonic/Set3"
+	mm "github.com/TomTonic/multimap"
+)
+
+// artMultiMap implements mm.MultiMap on top of a Tree guarded by a RWMutex.
+type artMultiMap[T comparable] struct {
+	mu   sync.RWMutex
+	tree *Tree[T]
+}
+
+// NewART returns a new MultiMap backed by an adaptive radix tree. Lookups and
+// insertions cost O(len(key)) instead of the O(number of keys) scans of the
+// array-based implementation, and range queries walk only the subtrees that
+// overlap the queried range. The constructor lives in this package rather
+// than in package multimap because the tree depends on multimap.Key.
+//
+// Unlike the array-based implementation, a key is removed as soon as its last
+// value is removed via RemoveValue.
+func NewART[T comparable]() mm.MultiMap[T] { return newARTMultiMap[T]() }
+
+func newARTMultiMap[T comparable]() *artMultiMap[T] {
+	return &artMultiMap[T]{tree: NewTree[T]()}
+}
+
+func (m *artMultiMap[T]) AddValue(key mm.Key, v T) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tree.Insert(key, v)
+}
+
+func (m *artMultiMap[T]) RemoveValue(key mm.Key, v T) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tree.RemoveValue(key, v)
+}
+
+func (m *artMultiMap[T]) ContainsKey(key mm.Key) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tree.Contains(key)
+}
+
+func (m *artMultiMap[T]) RemoveKey(key mm.Key) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tree.Delete(key)
+}
+
+func (m *artMultiMap[T]) ValuesFor(key mm.Key) *set3.Set3[T] {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tree.Get(key)
+}
+
+func (m *artMultiMap[T]) AllValues() *set3.Set3[T] {
+	return m.valuesIn(keyRange{})
+}
+
+func (m *artMultiMap[T]) ValuesBetweenInclusive(from, to mm.Key) *set3.Set3[T] {
+	return m.valuesIn(keyRange{from: from, to: to, hasFrom: true, hasTo: true, fromIncl: true, toIncl: true})
+}
+
+func (m *artMultiMap[T]) ValuesBetweenExclusive(from, to mm.Key) *set3.Set3[T] {
+	return m.valuesIn(keyRange{from: from, to: to, hasFrom: true, hasTo: true})
+}
+
+func (m *artMultiMap[T]) ValuesFromInclusive(from mm.Key) *set3.Set3[T] {
+	return m.valuesIn(keyRange{from: from, hasFrom: true, fromIncl: true})
+}
+
+func (m *artMultiMap[T]) ValuesFromExclusive(from mm.Key) *set3.Set3[T] {
+	return m.valuesIn(keyRange{from: from, hasFrom: true})
+}
+
+func (m *artMultiMap[T]) ValuesToInclusive(to mm.Key) *set3.Set3[T] {
+	return m.valuesIn(keyRange{to: to, hasTo: true, toIncl: true})
+}
+
+func (m *artMultiMap[T]) ValuesToExclusive(to mm.Key) *set3.Set3[T] {
+	return m.valuesIn(keyRange{to: to, hasTo: true})
+}
+
+func (m *artMultiMap[T]) ValuesWithPrefix(prefix mm.Key) *set3.Set3[T] {
+	return m.valuesIn(prefixRange(prefix))
+}
+
+// valuesIn returns the union of the value sets of all keys in r. Only the
+// subtrees overlapping r are visited.
+func (m *artMultiMap[T]) valuesIn(r keyRange) *set3.Set3[T] {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := set3.Empty[T]()
+	m.tree.walkRange(r, func(_ mm.Key, n *Node[T]) bool {
+		result.AddAll(n.value.Set3)
+		return true
+	})
+	return result
+}
+
+func (m *artMultiMap[T]) Floor(key mm.Key) (mm.Key, *set3.Set3[T], bool) {
+	return m.nearest(keyRange{to: key, hasTo: true, toIncl: true}, true)
+}
+
+func (m *artMultiMap[T]) Ceiling(key mm.Key) (mm.Key, *set3.Set3[T], bool) {
+	return m.nearest(keyRange{from: key, hasFrom: true, fromIncl: true}, false)
+}
+
+func (m *artMultiMap[T]) Lower(key mm.Key) (mm.Key, *set3.Set3[T], bool) {
+	return m.nearest(keyRange{to: key, hasTo: true}, true)
+}
+
+func (m *artMultiMap[T]) Higher(key mm.Key) (mm.Key, *set3.Set3[T], bool) {
+	return m.nearest(keyRange{from: key, hasFrom: true}, false)
+}
+
+func (m *artMultiMap[T]) LongestPrefixMatch(key mm.Key) (mm.Key, *set3.Set3[T], bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tree.LongestPrefixMatch(key)
+}
+
+func (m *artMultiMap[T]) FirstKey() (mm.Key, bool) {
+	k, _, found := m.nearest(keyRange{}, false)
+	return k, found
+}
+
+func (m *artMultiMap[T]) LastKey() (mm.Key, bool) {
+	k, _, found := m.nearest(keyRange{}, true)
+	return k, found
+}
+
+func (m *artMultiMap[T]) PopFirst() (mm.Key, *set3.Set3[T], bool) {
+	return m.pop(false)
+}
+
+func (m *artMultiMap[T]) PopLast() (mm.Key, *set3.Set3[T], bool) {
+	return m.pop(true)
+}
+
+// nearest returns the first key of r in ascending order, or in descending
+// order if descending is set, together with a clone of its values.
+func (m *artMultiMap[T]) nearest(r keyRange, descending bool) (mm.Key, *set3.Set3[T], bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tree.first(r, descending)
+}
+
+// PopFirstMatching atomically removes the smallest key accepted by accept and
+// returns it with its values. Rejected keys are left in place. TypedMultiMap
+// uses it to skip keys its codec cannot decode. accept is called with the
+// lock held and must not call methods of m.
+func (m *artMultiMap[T]) PopFirstMatching(accept func(mm.Key) bool) (mm.Key, *set3.Set3[T], bool) {
+	return m.popMatching(false, accept)
+}
+
+// PopLastMatching is like PopFirstMatching but removes the greatest accepted
+// key.
+func (m *artMultiMap[T]) PopLastMatching(accept func(mm.Key) bool) (mm.Key, *set3.Set3[T], bool) {
+	return m.popMatching(true, accept)
+}
+
+// pop removes the smallest key, or the greatest one if last is set, and
+// returns it with its values while holding the write lock throughout.
+func (m *artMultiMap[T]) pop(last bool) (mm.Key, *set3.Set3[T], bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, values, found := m.tree.first(keyRange{}, last)
+	if found {
+		m.tree.Delete(key)
+	}
+	return key, values, found
+}
+
+// popMatching is like pop but skips the keys rejected by accept.
+func (m *artMultiMap[T]) popMatching(last bool, accept func(mm.Key) bool) (mm.Key, *set3.Set3[T], bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var key mm.Key
+	values := set3.EmptyWithCapacity[T](0)
+	found := false
+	visit := func(k mm.Key, n *Node[T]) bool {
+		if !accept(k) {
+			return true
+		}
+		key, values, found = k.Clone(), n.GetValues(), true
+		return false
+	}
+	if last {
+		m.tree.walkRangeDescending(keyRange{}, visit)
+	} else {
+		m.tree.walkRange(keyRange{}, visit)
+	}
+	if found {
+		m.tree.Delete(key)
+	}
+	return key, values, found
+}
+
+func (m *artMultiMap[T]) NumberOfKeys() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tree.Size()
+}
+
+func (m *artMultiMap[T]) AllKeys() []mm.Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]mm.Key, 0, m.tree.Size())
+	m.tree.walkRange(keyRange{}, func(k mm.Key, _ *Node[T]) bool {
+		result = append(result, k.Clone())
+		return true
+	})
+	return result
+}
+
+// iterBatchSize is the number of keys an iterator reads per lock acquisition.
+const iterBatchSize = 64
+
+func (m *artMultiMap[T]) All() iter.Seq2[mm.Key, *set3.Set3[T]] {
+	return batched(m, keyRange{}, (*Node[T]).GetValues)
+}
+
+// ViewAll calls f with an iterator over all keys and their values in
+// ascending order while holding the read lock, so f sees a consistent state
+// of m and writers block until f returns. The yielded keys and sets belong to
+// m and must not be modified or retained, and f must not write to m.
+// mm.WriteBinary uses it to write consistent snapshots.
+func (m *artMultiMap[T]) ViewAll(f func(all iter.Seq2[mm.Key, *set3.Set3[T]]) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return f(func(yield func(mm.Key, *set3.Set3[T]) bool) {
+		m.tree.walkRange(keyRange{}, func(k mm.Key, n *Node[T]) bool {
+			return yield(k, n.value.Set3)
+		})
+	})
+}
+
+func (m *artMultiMap[T]) Range(from, to mm.Key, inclusive bool) iter.Seq2[mm.Key, *set3.Set3[T]] {
+	r := keyRange{from: from, to: to, hasFrom: true, hasTo: true, fromIncl: inclusive, toIncl: inclusive}
+	return batched(m, r, (*Node[T]).GetValues)
+}
+
+func (m *artMultiMap[T]) EntriesBetweenInclusive(from, to mm.Key) iter.Seq2[mm.Key, *set3.Set3[T]] {
+	return batched(m, keyRange{from: from, to: to, hasFrom: true, hasTo: true, fromIncl: true, toIncl: true}, (*Node[T]).GetValues)
+}
+
+func (m *artMultiMap[T]) EntriesBetweenExclusive(from, to mm.Key) iter.Seq2[mm.Key, *set3.Set3[T]] {
+	return batched(m, keyRange{from: from, to: to, hasFrom: true, hasTo: true}, (*Node[T]).GetValues)
+}
+
+func (m *artMultiMap[T]) EntriesFromInclusive(from mm.Key) iter.Seq2[mm.Key, *set3.Set3[T]] {
+	return batched(m, keyRange{from: from, hasFrom: true, fromIncl: true}, (*Node[T]).GetValues)
+}
+
+func (m *artMultiMap[T]) EntriesFromExclusive(from mm.Key) iter.Seq2[mm.Key, *set3.Set3[T]] {
+	return batched(m, keyRange{from: from, hasFrom: true}, (*Node[T]).GetValues)
+}
+
+func (m *artMultiMap[T]) EntriesToInclusive(to mm.Key) iter.Seq2[mm.Key, *set3.Set3[T]] {
+	return batched(m, keyRange{to: to, hasTo: true, toIncl: true}, (*Node[T]).GetValues)
+}
+
+func (m *artMultiMap[T]) EntriesToExclusive(to mm.Key) iter.Seq2[mm.Key, *set3.Set3[T]] {
+	return batched(m, keyRange{to: to, hasTo: true}, (*Node[T]).GetValues)
+}
+
+func (m *artMultiMap[T]) Keys() iter.Seq[mm.Key] {
+	return m.keysIn(keyRange{})
+}
+
+func (m *artMultiMap[T]) KeysWithPrefix(prefix mm.Key) iter.Seq[mm.Key] {
+	return m.keysIn(prefixRange(prefix))
+}
+
+// keysIn returns an iterator over the keys in r in ascending order.
+func (m *artMultiMap[T]) keysIn(r keyRange) iter.Seq[mm.Key] {
+	return func(yield func(mm.Key) bool) {
+		for k := range batched(m, r, func(*Node[T]) struct{} { return struct{}{} }) {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+func (m *artMultiMap[T]) Values() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for _, vals := range batched(m, keyRange{}, func(n *Node[T]) []T { return n.value.ToArray() }) {
+			for _, v := range vals {
+				if !yield(v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// batched returns an iterator over the keys in r in ascending order. For every
+// key, capture is called with the read lock held and its result is yielded
+// together with a clone of the key. Keys are read in batches of iterBatchSize;
+// the lock is released before a batch is yielded and each new batch resumes
+// after the last key of the previous one.
+func batched[T comparable, V any](m *artMultiMap[T], r keyRange, capture func(n *Node[T]) V) iter.Seq2[mm.Key, V] {
+	return func(yield func(mm.Key, V) bool) {
+		keys := make([]mm.Key, 0, iterBatchSize)
+		captured := make([]V, 0, iterBatchSize)
+		for {
+			keys, captured = keys[:0], captured[:0]
+			m.mu.RLock()
+			m.tree.walkRange(r, func(k mm.Key, n *Node[T]) bool {
+				keys = append(keys, k.Clone())
+				captured = append(captured, capture(n))
+				return len(keys) < iterBatchSize
+			})
+			m.mu.RUnlock()
+			if len(keys) == 0 {
+				return
+			}
+			// keep a private copy, the caller may modify the yielded keys
+			last := keys[len(keys)-1].Clone()
+			for i := range keys {
+				if !yield(keys[i], captured[i]) {
+					return
+				}
+			}
+			if len(keys) < iterBatchSize {
+				return
+			}
+			r.from, r.hasFrom, r.fromIncl = last, true, false
+		}
+	}
+}
+
+func (m *artMultiMap[T]) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tree = NewTree[T]()
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using mm.MarshalBinary.
+func (m *artMultiMap[T]) MarshalBinary() ([]byte, error) {
+	return mm.MarshalBinary[T](m)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler using
+// mm.UnmarshalBinary. It replaces the contents of m; if data is invalid, m is
+// left unchanged.
+func (m *artMultiMap[T]) UnmarshalBinary(data []byte) error {
+	loaded := newARTMultiMap[T]()
+	if err := mm.UnmarshalBinary[T](data, loaded); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tree = loaded.tree
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler using mm.MarshalJSON.
+func (m *artMultiMap[T]) MarshalJSON() ([]byte, error) {
+	return mm.MarshalJSON[T](m)
+}
+
+// UnmarshalJSON implements json.Unmarshaler using mm.UnmarshalJSON. It
+// replaces the contents of m; if data is invalid, m is left unchanged.
+func (m *artMultiMap[T]) UnmarshalJSON(data []byte) error {
+	loaded := newARTMultiMap[T]()
+	if err := mm.UnmarshalJSON[T](data, loaded); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tree = loaded.tree
+	return nil
+}
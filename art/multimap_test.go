@@ -0,0 +1,869 @@
+package art
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"math/rand"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	set3 "github.com/TomTonic/Set3"
+	mm "github.com/TomTonic/multimap"
+)
+
+// implementations lists every MultiMap constructor the behavior tests below
+// are run against, so the ART-backed map is checked against the same
+// expectations as the array-based one.
+var implementations = []struct {
+	name string
+	new  func() mm.MultiMap[int]
+}{
+	{"ArrayBased", mm.NewArrayBased[int]},
+	{"ART", NewART[int]},
+}
+
+func TestMultiMap_PutSizeAndContains(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			if m.NumberOfKeys() != 0 {
+				t.Fatalf("new map should be empty")
+			}
+			m.AddValue(mm.FromString("k1"), 1)
+			m.AddValue(mm.FromString("k1"), 2)
+			if m.NumberOfKeys() != 1 || !m.ContainsKey(mm.FromString("k1")) {
+				t.Fatalf("expected exactly key k1 after adding two values")
+			}
+			m.AddValue(mm.FromString("k2"), 3)
+			if m.NumberOfKeys() != 2 {
+				t.Fatalf("expected size 2 after adding k2, got %d", m.NumberOfKeys())
+			}
+		})
+	}
+}
+
+func TestMultiMap_KeysRemoveKeyAndClear(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			m.AddValue(mm.FromString("a"), 1)
+			m.AddValue(mm.FromString("b"), 2)
+			if len(m.AllKeys()) != int(m.NumberOfKeys()) {
+				t.Fatalf("AllKeys length does not match NumberOfKeys")
+			}
+			m.RemoveKey(mm.FromString("a"))
+			m.RemoveKey(mm.FromString("missing"))
+			if m.ContainsKey(mm.FromString("a")) || m.NumberOfKeys() != 1 {
+				t.Fatalf("expected a to be removed")
+			}
+			m.Clear()
+			if m.NumberOfKeys() != 0 || len(m.AllKeys()) != 0 || m.AllValues().Size() != 0 {
+				t.Fatalf("expected empty map after Clear")
+			}
+		})
+	}
+}
+
+func TestMultiMap_RangeQueriesReturnExpectedSets(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			m.AddValue(mm.FromString("b"), 2)
+			m.AddValue(mm.FromString("d"), 4)
+			m.AddValue(mm.FromString("f"), 6)
+			m.AddValue(mm.FromString("ff"), 7)
+
+			tests := []struct {
+				name string
+				got  *set3.Set3[int]
+				want *set3.Set3[int]
+			}{
+				{"BetweenInclusive(b,f)", m.ValuesBetweenInclusive(mm.FromString("b"), mm.FromString("f")), set3.From(2, 4, 6)},
+				{"BetweenInclusive(c,e)", m.ValuesBetweenInclusive(mm.FromString("c"), mm.FromString("e")), set3.From(4)},
+				{"BetweenInclusive(f,b)", m.ValuesBetweenInclusive(mm.FromString("f"), mm.FromString("b")), set3.Empty[int]()},
+				{"BetweenExclusive(b,f)", m.ValuesBetweenExclusive(mm.FromString("b"), mm.FromString("f")), set3.From(4)},
+				{"FromInclusive(d)", m.ValuesFromInclusive(mm.FromString("d")), set3.From(4, 6, 7)},
+				{"FromExclusive(f)", m.ValuesFromExclusive(mm.FromString("f")), set3.From(7)},
+				{"ToInclusive(d)", m.ValuesToInclusive(mm.FromString("d")), set3.From(2, 4)},
+				{"ToExclusive(ff)", m.ValuesToExclusive(mm.FromString("ff")), set3.From(2, 4, 6)},
+				{"ToInclusive(a)", m.ValuesToInclusive(mm.FromString("a")), set3.Empty[int]()},
+				{"FromInclusive(z)", m.ValuesFromInclusive(mm.FromString("z")), set3.Empty[int]()},
+				{"AllValues", m.AllValues(), set3.From(2, 4, 6, 7)},
+			}
+			for _, tc := range tests {
+				if tc.got == nil || !tc.got.Equals(tc.want) {
+					t.Fatalf("%s = %v, want %v", tc.name, tc.got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiMap_RangeQueriesWithNegativeInts(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			for _, v := range []int{-3, -1, 0, 2} {
+				m.AddValue(mm.FromInt64(int64(v)), v)
+			}
+			if res := m.ValuesBetweenInclusive(mm.FromInt64(-2), mm.FromUint64(1)); !res.Equals(set3.From(-1, 0)) {
+				t.Fatalf("BetweenInclusive(-2,1) = %v", res)
+			}
+			if res := m.ValuesToInclusive(mm.FromUint64(0)); !res.Equals(set3.From(-3, -1, 0)) {
+				t.Fatalf("ToInclusive(0) = %v", res)
+			}
+			if res := m.ValuesFromExclusive(mm.FromInt64(0)); !res.Equals(set3.From(2)) {
+				t.Fatalf("FromExclusive(0) = %v", res)
+			}
+		})
+	}
+}
+
+func TestMultiMap_RemoveValueAndValuesForClone(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			k := mm.FromString("key")
+			m.AddValue(k, 1)
+			m.AddValue(k, 2)
+			m.RemoveValue(k, 1)
+			res := m.ValuesFor(k)
+			if !res.Equals(set3.From(2)) {
+				t.Fatalf("after RemoveValue expected {2}, got %v", res)
+			}
+			res.Add(999)
+			if !m.ValuesFor(k).Equals(set3.From(2)) {
+				t.Fatalf("modifying returned set should not affect stored data")
+			}
+			all := m.AllValues()
+			all.Add(998)
+			if m.AllValues().Contains(998) {
+				t.Fatalf("modifying AllValues result should not affect stored data")
+			}
+			m.RemoveValue(k, 42)
+			if !m.ValuesFor(k).Equals(set3.From(2)) {
+				t.Fatalf("RemoveValue non-existent mutated set")
+			}
+			if m.ValuesFor(mm.FromString("missing")) == nil {
+				t.Fatalf("ValuesFor must never return nil")
+			}
+		})
+	}
+}
+
+func TestMultiMap_PutClonesKey(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			k := mm.Key([]byte{0x61})
+			m.AddValue(k, 7)
+			k[0] = 0x62
+			keys := m.AllKeys()
+			if len(keys) != 1 || keys[0][0] != 0x61 {
+				t.Fatalf("stored key was mutated when original key changed")
+			}
+			keys[0][0] = 0x63
+			if !m.ContainsKey(mm.Key{0x61}) {
+				t.Fatalf("mutating a key returned by AllKeys changed the stored key")
+			}
+		})
+	}
+}
+
+func TestMultiMap_ConcurrentPuts(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			done := make(chan struct{})
+			for i := 0; i < 10; i++ {
+				go func(i int) {
+					for j := 0; j < 100; j++ {
+						m.AddValue(mm.FromInt(j%10), i*100+j)
+						m.ValuesFromInclusive(mm.FromInt(5))
+					}
+					done <- struct{}{}
+				}(i)
+			}
+			for i := 0; i < 10; i++ {
+				<-done
+			}
+			if m.NumberOfKeys() != 10 || m.AllValues().Size() != 1000 {
+				t.Fatalf("expected 10 keys with 1000 values after concurrent puts")
+			}
+		})
+	}
+}
+
+// TestNewART_matchesArrayBased runs the same random operations against both
+// implementations and compares every observable result.
+func TestNewART_matchesArrayBased(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	want := mm.NewArrayBased[int]()
+	got := NewART[int]()
+	randomKey := func() mm.Key {
+		k := make(mm.Key, rng.Intn(5))
+		for j := range k {
+			k[j] = byte(rng.Intn(4)) * 0x40
+		}
+		return k
+	}
+	for i := 0; i < 5000; i++ {
+		k := randomKey()
+		switch rng.Intn(4) {
+		case 0, 1:
+			want.AddValue(k, i%7)
+			got.AddValue(k, i%7)
+		case 2:
+			want.RemoveKey(k)
+			got.RemoveKey(k)
+		case 3:
+			from, to := randomKey(), randomKey()
+			if !got.ValuesBetweenInclusive(from, to).Equals(want.ValuesBetweenInclusive(from, to)) ||
+				!got.ValuesBetweenExclusive(from, to).Equals(want.ValuesBetweenExclusive(from, to)) ||
+				!got.ValuesFromExclusive(from).Equals(want.ValuesFromExclusive(from)) ||
+				!got.ValuesToInclusive(to).Equals(want.ValuesToInclusive(to)) ||
+				!got.ValuesWithPrefix(from).Equals(want.ValuesWithPrefix(from)) {
+				t.Fatalf("range query [%v,%v] differs from array-based implementation", from, to)
+			}
+			gk, gv, gf := got.LongestPrefixMatch(from)
+			wk, wv, wf := want.LongestPrefixMatch(from)
+			if gf != wf || !gk.Equal(wk) || !gv.Equals(wv) {
+				t.Fatalf("longest prefix match for %v differs from array-based implementation", from)
+			}
+		}
+		if got.ContainsKey(k) != want.ContainsKey(k) || !got.ValuesFor(k).Equals(want.ValuesFor(k)) {
+			t.Fatalf("content for key %v differs from array-based implementation", k)
+		}
+	}
+	if !equalKeys(got.AllKeys(), want.AllKeys()) || !got.AllValues().Equals(want.AllValues()) {
+		t.Fatalf("final content differs from array-based implementation")
+	}
+}
+
+func TestMultiMap_IteratorsMatchBulkMethods(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			for i := 0; i < 3*iterBatchSize; i++ {
+				m.AddValue(mm.FromInt(i%150), i)
+			}
+			keys := 0
+			values := set3.Empty[int]()
+			for k, vals := range m.All() {
+				keys++
+				if !vals.Equals(m.ValuesFor(k)) {
+					t.Fatalf("All() yielded wrong set for key %v", k)
+				}
+			}
+			for v := range m.Values() {
+				values.Add(v)
+			}
+			if keys != int(m.NumberOfKeys()) || !values.Equals(m.AllValues()) {
+				t.Fatalf("iterators do not match NumberOfKeys/AllValues")
+			}
+			ranged := set3.Empty[int]()
+			for _, vals := range m.Range(mm.FromInt(10), mm.FromInt(120), false) {
+				ranged.AddAll(vals)
+			}
+			if !ranged.Equals(m.ValuesBetweenExclusive(mm.FromInt(10), mm.FromInt(120))) {
+				t.Fatalf("Range() does not match ValuesBetweenExclusive")
+			}
+		})
+	}
+}
+
+func TestNewART_iteratorsAscendingAcrossBatches(t *testing.T) {
+	m := NewART[int]()
+	for i := 3*iterBatchSize + 7; i >= 0; i-- {
+		m.AddValue(mm.FromInt(i), i)
+	}
+	want := 0
+	for k := range m.Keys() {
+		if !k.Equal(mm.FromInt(want)) {
+			t.Fatalf("Keys() yielded %v at position %d", k, want)
+		}
+		k[0] = 0xFF // must not disturb the iteration
+		want++
+	}
+	if want != 3*iterBatchSize+8 {
+		t.Fatalf("Keys() yielded %d keys, want %d", want, 3*iterBatchSize+8)
+	}
+}
+
+func TestNewART_iteratorAllowsModification(t *testing.T) {
+	m := NewART[int]()
+	for i := 0; i < 2*iterBatchSize; i++ {
+		m.AddValue(mm.FromInt(i), i)
+	}
+	visited := 0
+	for k := range m.All() {
+		m.RemoveKey(k)
+		m.AddValue(mm.FromInt(-1), visited) // smaller than all keys, never yielded
+		visited++
+	}
+	if visited != 2*iterBatchSize || m.NumberOfKeys() != 1 {
+		t.Fatalf("expected to visit and remove every key, visited=%d left=%d", visited, m.NumberOfKeys())
+	}
+}
+
+func TestMultiMap_EntriesMatchRangeQueries(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			for i := 0; i < 500; i++ {
+				m.AddValue(mm.FromInt(i%170), i)
+			}
+			from, to := mm.FromInt(20), mm.FromInt(150)
+			tests := []struct {
+				name    string
+				entries iter.Seq2[mm.Key, *set3.Set3[int]]
+				want    *set3.Set3[int]
+			}{
+				{"BetweenInclusive", m.EntriesBetweenInclusive(from, to), m.ValuesBetweenInclusive(from, to)},
+				{"BetweenExclusive", m.EntriesBetweenExclusive(from, to), m.ValuesBetweenExclusive(from, to)},
+				{"FromInclusive", m.EntriesFromInclusive(from), m.ValuesFromInclusive(from)},
+				{"FromExclusive", m.EntriesFromExclusive(from), m.ValuesFromExclusive(from)},
+				{"ToInclusive", m.EntriesToInclusive(to), m.ValuesToInclusive(to)},
+				{"ToExclusive", m.EntriesToExclusive(to), m.ValuesToExclusive(to)},
+			}
+			for _, tc := range tests {
+				union := set3.Empty[int]()
+				var prev mm.Key
+				for k, vals := range tc.entries {
+					if prev != nil && !prev.LessThan(k) {
+						t.Fatalf("%s: key %v yielded after %v", tc.name, k, prev)
+					}
+					if !vals.Equals(m.ValuesFor(k)) {
+						t.Fatalf("%s: wrong set for key %v", tc.name, k)
+					}
+					union.AddAll(vals)
+					prev = k
+				}
+				if !union.Equals(tc.want) {
+					t.Fatalf("%s: union of entries differs from the flattened range query", tc.name)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiMap_PrefixQueriesWithTrailingFF(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			keys := []mm.Key{{0x01}, {0x01, 0xFF}, {0x01, 0xFF, 0x00}, {0x01, 0xFF, 0xFF}, {0x02}, {0xFF}, {0xFF, 0xFF, 0x01}}
+			for i, k := range keys {
+				m.AddValue(k, i)
+			}
+			tests := []struct {
+				prefix mm.Key
+				want   *set3.Set3[int]
+			}{
+				{mm.Key{}, set3.From(0, 1, 2, 3, 4, 5, 6)},
+				{mm.Key{0x01}, set3.From(0, 1, 2, 3)},
+				{mm.Key{0x01, 0xFF}, set3.From(1, 2, 3)},
+				{mm.Key{0x01, 0xFF, 0xFF}, set3.From(3)},
+				{mm.Key{0xFF}, set3.From(5, 6)},
+				{mm.Key{0xFF, 0xFF}, set3.From(6)},
+				{mm.Key{0x03}, set3.Empty[int]()},
+			}
+			for _, tc := range tests {
+				if got := m.ValuesWithPrefix(tc.prefix); !got.Equals(tc.want) {
+					t.Fatalf("ValuesWithPrefix(%v) = %v, want %v", tc.prefix, got, tc.want)
+				}
+				n := 0
+				for k := range m.KeysWithPrefix(tc.prefix) {
+					if !k.HasPrefix(tc.prefix) {
+						t.Fatalf("KeysWithPrefix(%v) yielded %v", tc.prefix, k)
+					}
+					n++
+				}
+				if n != int(tc.want.Size()) {
+					t.Fatalf("KeysWithPrefix(%v) yielded %d keys, want %d", tc.prefix, n, tc.want.Size())
+				}
+			}
+		})
+	}
+}
+
+func TestMultiMap_FloorCeilingLowerHigher(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			for _, tier := range []int{0, 100, 1000} {
+				m.AddValue(mm.FromInt(tier), tier)
+			}
+			type lookup func(mm.Key) (mm.Key, *set3.Set3[int], bool)
+			tests := []struct {
+				name  string
+				f     lookup
+				key   int
+				want  int
+				found bool
+			}{
+				{"Floor", m.Floor, 500, 100, true},
+				{"Floor", m.Floor, 100, 100, true},
+				{"Floor", m.Floor, -1, 0, false},
+				{"Ceiling", m.Ceiling, 500, 1000, true},
+				{"Ceiling", m.Ceiling, 100, 100, true},
+				{"Ceiling", m.Ceiling, 1001, 0, false},
+				{"Lower", m.Lower, 100, 0, true},
+				{"Lower", m.Lower, 0, 0, false},
+				{"Higher", m.Higher, 100, 1000, true},
+				{"Higher", m.Higher, 1000, 0, false},
+			}
+			for _, tc := range tests {
+				k, vals, found := tc.f(mm.FromInt(tc.key))
+				if found != tc.found || vals == nil {
+					t.Fatalf("%s(%d): found=%v, want %v", tc.name, tc.key, found, tc.found)
+				}
+				if !found {
+					if k != nil || vals.Size() != 0 {
+						t.Fatalf("%s(%d) returned %v %v without a match", tc.name, tc.key, k, vals)
+					}
+					continue
+				}
+				if !k.Equal(mm.FromInt(tc.want)) || !vals.Equals(set3.From(tc.want)) {
+					t.Fatalf("%s(%d) = %v %v, want %d", tc.name, tc.key, k, vals, tc.want)
+				}
+				vals.Add(-7)
+				k[0] = 0xFF
+				if !m.ValuesFor(mm.FromInt(tc.want)).Equals(set3.From(tc.want)) {
+					t.Fatalf("%s(%d) returned shared key or values", tc.name, tc.key)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiMap_FirstLastAndPop(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			if _, ok := m.FirstKey(); ok {
+				t.Fatalf("FirstKey on an empty map should not find a key")
+			}
+			if k, vals, ok := m.PopLast(); ok || k != nil || vals == nil || vals.Size() != 0 {
+				t.Fatalf("PopLast on an empty map should return nil, an empty set and false")
+			}
+			for _, deadline := range []int64{30, -5, 10, 20} {
+				m.AddValue(mm.FromInt64(deadline), int(deadline))
+			}
+			if k, ok := m.FirstKey(); !ok || !k.Equal(mm.FromInt64(-5)) {
+				t.Fatalf("FirstKey = %v, want -5", k)
+			}
+			if k, ok := m.LastKey(); !ok || !k.Equal(mm.FromInt64(30)) {
+				t.Fatalf("LastKey = %v, want 30", k)
+			}
+			if k, vals, ok := m.PopFirst(); !ok || !k.Equal(mm.FromInt64(-5)) || !vals.Equals(set3.From(-5)) {
+				t.Fatalf("PopFirst = %v %v, want -5", k, vals)
+			}
+			if k, vals, ok := m.PopLast(); !ok || !k.Equal(mm.FromInt64(30)) || !vals.Equals(set3.From(30)) {
+				t.Fatalf("PopLast = %v %v, want 30", k, vals)
+			}
+			if m.NumberOfKeys() != 2 || m.ContainsKey(mm.FromInt64(-5)) || m.ContainsKey(mm.FromInt64(30)) {
+				t.Fatalf("popped keys should be removed")
+			}
+		})
+	}
+}
+
+func TestMultiMap_ConcurrentPopsTakeEachKeyOnce(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			const numKeys = 1000
+			for i := 0; i < numKeys; i++ {
+				m.AddValue(mm.FromInt(i), i)
+			}
+			results := make(chan *set3.Set3[int])
+			for g := 0; g < 8; g++ {
+				go func(g int) {
+					popped := set3.Empty[int]()
+					for {
+						pop := m.PopFirst
+						if g%2 == 1 {
+							pop = m.PopLast
+						}
+						_, vals, ok := pop()
+						if !ok {
+							break
+						}
+						popped.AddAll(vals)
+					}
+					results <- popped
+				}(g)
+			}
+			total := set3.Empty[int]()
+			sum := 0
+			for g := 0; g < 8; g++ {
+				popped := <-results
+				sum += int(popped.Size())
+				total.AddAll(popped)
+			}
+			if sum != numKeys || total.Size() != numKeys || m.NumberOfKeys() != 0 {
+				t.Fatalf("expected every key to be popped exactly once, popped %d (%d distinct)", sum, total.Size())
+			}
+		})
+	}
+}
+
+func TestMultiMap_LongestPrefixMatch(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			for i, cidr := range []string{"10.0.0.0/8", "10.128.0.0/9", "10.128.7.0/24", "10.128.7.5/32", "2001:db8::/32", "2001:db8:0:1::/64"} {
+				m.AddValue(mm.FromPrefix(netip.MustParsePrefix(cidr)), i)
+			}
+			tests := []struct {
+				addr  string
+				want  string
+				found bool
+			}{
+				{"10.1.1.1", "10.0.0.0/8", true},
+				{"10.128.0.1", "10.128.0.0/9", true},
+				{"10.128.7.4", "10.128.7.0/24", true},
+				{"10.128.7.5", "10.128.7.5/32", true},
+				{"2001:db8:0:1::42", "2001:db8:0:1::/64", true},
+				{"2001:db8:0:2::42", "2001:db8::/32", true},
+				{"11.0.0.1", "", false},
+			}
+			for _, tc := range tests {
+				k, vals, found := m.LongestPrefixMatch(mm.FromAddr(netip.MustParseAddr(tc.addr)))
+				if found != tc.found || vals == nil {
+					t.Fatalf("LongestPrefixMatch(%s): found=%v, want %v", tc.addr, found, tc.found)
+				}
+				if !found {
+					continue
+				}
+				p, err := k.Prefix()
+				if err != nil || p != netip.MustParsePrefix(tc.want) || !vals.Equals(m.ValuesFor(k)) {
+					t.Fatalf("LongestPrefixMatch(%s) = %v %v, want %s", tc.addr, p, vals, tc.want)
+				}
+			}
+			m.AddValue(mm.Key{}, -1)
+			if k, _, found := m.LongestPrefixMatch(mm.FromString("x")); !found || len(k) != 0 {
+				t.Fatalf("the empty key should match every key, got %v %v", k, found)
+			}
+		})
+	}
+}
+
+func TestMultiMap_ValuesInBox(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			rng := rand.New(rand.NewSource(11))
+			type point struct{ x, y uint32 }
+			points := make([]point, 2000)
+			for i := range points {
+				points[i] = point{uint32(rng.Intn(1 << 12)), uint32(rng.Intn(1 << 12))}
+				m.AddValue(mm.FromMorton2D(points[i].x, points[i].y), i)
+			}
+			for i := 0; i < 50; i++ {
+				minX, minY := uint32(rng.Intn(1<<12)), uint32(rng.Intn(1<<12))
+				maxX, maxY := minX+uint32(rng.Intn(1<<10)), minY+uint32(rng.Intn(1<<10))
+				want := set3.Empty[int]()
+				for j, p := range points {
+					if minX <= p.x && p.x <= maxX && minY <= p.y && p.y <= maxY {
+						want.Add(j)
+					}
+				}
+				if got := mm.ValuesInBox(m, minX, minY, maxX, maxY); !got.Equals(want) {
+					t.Fatalf("ValuesInBox(%d,%d,%d,%d) returned %d values, want %d", minX, minY, maxX, maxY, got.Size(), want.Size())
+				}
+			}
+		})
+	}
+}
+
+func TestMultiMap_TypedWrapper(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := mm.WrapTyped(impl.new(), mm.IntCodec[int]{})
+			for i := -50; i <= 50; i += 5 {
+				m.AddValue(i, i*2)
+			}
+			var got []int
+			for k, values := range m.Range(-10, 10, true) {
+				if !values.Equals(set3.From(k * 2)) {
+					t.Fatalf("unexpected values %v for key %d", values, k)
+				}
+				got = append(got, k)
+			}
+			if !slices.Equal(got, []int{-10, -5, 0, 5, 10}) {
+				t.Fatalf("Range(-10, 10) yielded %v", got)
+			}
+			if k, _, found := m.Ceiling(-12); !found || k != -10 {
+				t.Fatalf("Ceiling(-12) = %d, %v", k, found)
+			}
+			if k, found := m.LastKey(); !found || k != 50 {
+				t.Fatalf("LastKey() = %d, %v", k, found)
+			}
+		})
+	}
+}
+
+func TestMultiMap_TypedWrapperSkipsUndecodableKeys(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := mm.WrapTyped(impl.new(), mm.IntCodec[int]{})
+			m.AddValue(-1, 1)
+			m.AddValue(1, 2)
+			// sort before and after all integer keys
+			low, high := mm.FromString("x"), mm.FromString("\xff")
+			m.Unwrap().AddValue(low, 3)
+			m.Unwrap().AddValue(high, 4)
+			if k, values, found := m.PopFirst(); !found || k != -1 || !values.Equals(set3.From(1)) {
+				t.Fatalf("PopFirst() = %d, %v, %v", k, values, found)
+			}
+			if k, values, found := m.PopLast(); !found || k != 1 || !values.Equals(set3.From(2)) {
+				t.Fatalf("PopLast() = %d, %v, %v", k, values, found)
+			}
+			if _, _, found := m.PopFirst(); found || m.NumberOfKeys() != 2 {
+				t.Fatalf("PopFirst() should leave the undecodable keys in place")
+			}
+			if k, _, found := m.LongestPrefixMatch(5); found {
+				t.Fatalf("LongestPrefixMatch(5) = %d, want none", k)
+			}
+		})
+		t.Run(impl.name+"/Wrapped", func(t *testing.T) {
+			// a MultiMap outside this module is stepped through instead
+			m := mm.WrapTyped[int, int](struct{ mm.MultiMap[int] }{impl.new()}, mm.IntCodec[int]{})
+			m.AddValue(-1, 1)
+			m.AddValue(1, 2)
+			m.AddValue(2, 5)
+			m.Unwrap().AddValue(mm.FromString("x"), 3)
+			m.Unwrap().AddValue(mm.FromString("\xff"), 4)
+			if k, values, found := m.PopFirst(); !found || k != -1 || !values.Equals(set3.From(1)) {
+				t.Fatalf("PopFirst() = %d, %v, %v", k, values, found)
+			}
+			if k, values, found := m.PopLast(); !found || k != 2 || !values.Equals(set3.From(5)) {
+				t.Fatalf("PopLast() = %d, %v, %v", k, values, found)
+			}
+			if k, _, found := m.PopFirst(); !found || k != 1 {
+				t.Fatalf("PopFirst() = %d, %v", k, found)
+			}
+			if _, _, found := m.PopLast(); found || m.NumberOfKeys() != 2 {
+				t.Fatalf("PopLast() should leave the undecodable keys in place")
+			}
+		})
+	}
+}
+
+func TestMultiMap_BinaryRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			for i := 0; i < 2000; i++ {
+				m.AddValue(mm.FromInt(rng.Intn(500)), rng.Intn(1000)-500)
+			}
+			data, err := m.(encoding.BinaryMarshaler).MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, target := range implementations {
+				loaded := target.new()
+				loaded.AddValue(mm.FromString("replaced"), 1)
+				if err := loaded.(encoding.BinaryUnmarshaler).UnmarshalBinary(data); err != nil {
+					t.Fatalf("%s: %v", target.name, err)
+				}
+				if !equalEntries(m, loaded) {
+					t.Fatalf("%s does not match the marshaled map", target.name)
+				}
+			}
+		})
+	}
+}
+
+// equalEntries reports whether a and b hold the same keys with the same
+// values.
+func equalEntries(a, b mm.MultiMap[int]) bool {
+	keys := a.AllKeys()
+	if !slices.EqualFunc(keys, b.AllKeys(), mm.Key.Equal) {
+		return false
+	}
+	for _, k := range keys {
+		if !a.ValuesFor(k).Equals(b.ValuesFor(k)) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMultiMap_WriteBinaryIsConsistent(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := impl.new()
+			// the writer adds a high key, then a low key; a consistent
+			// snapshot holds as many low keys as high keys or one less
+			const n = 20000
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < n; i++ {
+					m.AddValue(append(mm.FromString("b"), mm.FromInt(i)...), i)
+					m.AddValue(append(mm.FromString("a"), mm.FromInt(i)...), i)
+				}
+			}()
+			for finished := false; !finished; {
+				select {
+				case <-done:
+					finished = true
+				default:
+				}
+				var buf bytes.Buffer
+				if _, err := mm.WriteBinary(&buf, m, mm.IntCodec[int]{}); err != nil {
+					t.Fatal(err)
+				}
+				loaded := mm.New[int]()
+				if _, err := mm.ReadBinary(&buf, loaded, mm.IntCodec[int]{}); err != nil {
+					t.Fatal(err)
+				}
+				low := loaded.ValuesWithPrefix(mm.FromString("a")).Size()
+				high := loaded.ValuesWithPrefix(mm.FromString("b")).Size()
+				if high != low && high != low+1 {
+					t.Fatalf("snapshot holds %d low and %d high keys", low, high)
+				}
+			}
+		})
+	}
+}
+
+func TestTypedMultiMap_MarshalJSONIsConsistent(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			m := mm.WrapTyped(impl.new(), mm.StringCodec{})
+			// same invariant as in TestMultiMap_WriteBinaryIsConsistent
+			const n = 20000
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < n; i++ {
+					m.AddValue(fmt.Sprintf("b%08d", i), i)
+					m.AddValue(fmt.Sprintf("a%08d", i), i)
+				}
+			}()
+			for finished := false; !finished; {
+				select {
+				case <-done:
+					finished = true
+				default:
+				}
+				data, err := json.Marshal(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var entries []struct {
+					Key    string `json:"key"`
+					Values []int  `json:"values"`
+				}
+				if err := json.Unmarshal(data, &entries); err != nil {
+					t.Fatal(err)
+				}
+				low, high := 0, 0
+				for _, e := range entries {
+					if strings.HasPrefix(e.Key, "a") {
+						low++
+					} else {
+						high++
+					}
+				}
+				if high != low && high != low+1 {
+					t.Fatalf("snapshot holds %d low and %d high keys", low, high)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiMap_JSONRoundTrip(t *testing.T) {
+	var outputs []string
+	for _, impl := range implementations {
+		m := impl.new()
+		rng := rand.New(rand.NewSource(12))
+		for i := 0; i < 500; i++ {
+			m.AddValue(mm.FromInt(rng.Intn(100)), rng.Intn(50))
+		}
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, string(data))
+		for _, target := range implementations {
+			loaded := target.new()
+			if err := json.Unmarshal(data, loaded); err != nil || !equalEntries(m, loaded) {
+				t.Fatalf("%s -> %s: round trip failed: %v", impl.name, target.name, err)
+			}
+		}
+	}
+	if outputs[0] != outputs[1] {
+		t.Fatalf("implementations produce different JSON for the same contents")
+	}
+}
+
+func TestMultiMap_DurableRecovery(t *testing.T) {
+	codec := mm.IntCodec[int]{}
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			dir := t.TempDir()
+			rng := rand.New(rand.NewSource(13))
+			want := impl.new()
+			d, err := mm.OpenDurable(dir, impl.new(), codec, mm.DurableOptions{Sync: mm.SyncNever})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3000; i++ {
+				k, v := mm.FromInt(rng.Intn(200)), rng.Intn(20)
+				switch op := rng.Intn(100); {
+				case op < 70:
+					d.AddValue(k, v)
+					want.AddValue(k, v)
+				case op < 90:
+					d.RemoveValue(k, v)
+					want.RemoveValue(k, v)
+				case op < 98:
+					d.RemoveKey(k)
+					want.RemoveKey(k)
+				default:
+					d.PopFirst()
+					want.PopFirst()
+				}
+				if i == 1500 {
+					if err := d.Snapshot(); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := d.Close(); err != nil {
+				t.Fatal(err)
+			}
+			recovered, err := mm.OpenDurable(dir, impl.new(), codec, mm.DurableOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer recovered.Close()
+			if !equalEntries(nonEmpty(want), nonEmpty(recovered)) {
+				t.Fatalf("recovered map differs from the expected one")
+			}
+		})
+	}
+}
+
+// nonEmpty returns a copy of m without keys whose sets of values are empty,
+// which the array-based implementation keeps after RemoveValue.
+func nonEmpty(m mm.MultiMap[int]) mm.MultiMap[int] {
+	result := mm.New[int]()
+	for k, values := range m.All() {
+		for v := range values.ImmutableRange() {
+			result.AddValue(k, v)
+		}
+	}
+	return result
+}
@@ -1,6 +1,9 @@
 package art
 
-import set3 "github.com/TomTonic/Set3"
+import (
+	set3 "github.com/TomTonic/Set3"
+	mm "github.com/TomTonic/multimap"
+)
 
 // NOTE:
 // - 64-bit architecture assumed (8-byte pointer width).
@@ -32,7 +35,8 @@ import set3 "github.com/TomTonic/Set3"
 //   scan overhead.
 
 const (
-	maxLocalPrefixLen = 14
+	maxLocalPrefixLen = 12
+	maxPrefixLen      = 1<<16 - 1 // limit of Node.prefixLen, longer paths are chained
 
 	maxChildrenLeaf     = 1
 	maxChildrenNode64   = 4
@@ -43,6 +47,19 @@ const (
 	maxChildrenFullNode = 256
 )
 
+// A node is demoted to the next smaller type once its number of children
+// drops to roughly 3/4 of the smaller type's capacity. The gap between the
+// grow threshold (node full) and the shrink threshold keeps a workload that
+// adds and removes the same key from reallocating nodes over and over.
+const (
+	shrinkNode64ToLeaf   = maxChildrenLeaf * 3 / 4     // 0
+	shrinkNode128To64    = maxChildrenNode64 * 3 / 4   // 3
+	shrinkNode256To128   = maxChildrenNode128 * 3 / 4  // 8
+	shrinkNode512To256   = maxChildrenNode256 * 3 / 4  // 18
+	shrinkNode1024To512  = maxChildrenNode512 * 3 / 4  // 37
+	shrinkFullNodeTo1024 = maxChildrenNode1024 * 3 / 4 // 80
+)
+
 // -----------------------------------------------------------------------------
 // Common base (header + value), 24 bytes total.
 //
@@ -50,18 +67,33 @@ const (
 //
 //	meta        : 1 byte  (high nibble = node kind, low nibble = inline prefix length)
 //	numChildren : 1 byte  (number of children, 0..k)
-//	localPrefix : 14 bytes (inline prefix payload)
-//	value       : 8 bytes  (*set3.Set3[T])
+//	prefixLen   : 2 bytes (full length of the compressed path)
+//	localPrefix : 12 bytes (inline prefix payload)
+//	value       : 8 bytes  (*valueSet[T])
 //
+// Path compression is a hybrid of the pessimistic and the optimistic approach:
+// the first maxLocalPrefixLen bytes of the compressed path are stored inline
+// and compared during lookups, the remaining prefixLen-maxLocalPrefixLen bytes
+// are skipped. Every node holding a value also stores its full key, so a lookup
+// that skipped bytes is verified against that key once it ends.
 // -----------------------------------------------------------------------------
 type Node[T comparable] struct {
 	meta        uint8
 	numChildren uint8
+	prefixLen   uint16
 	localPrefix [maxLocalPrefixLen]byte
-	value       *set3.Set3[T] // 8 B at offset 16 -> GC-scan friendly
+	value       *valueSet[T] // 8 B at offset 16 -> GC-scan friendly
 	// Total: 24 B
 }
 
+// valueSet is the set of values stored at a node together with the node's
+// full key. The key is needed to verify optimistic lookups and to restore
+// compressed path bytes that are not stored inline.
+type valueSet[T comparable] struct {
+	*set3.Set3[T]
+	key mm.Key
+}
+
 // -----------------------------------------------------------------------------
 // LeafNode — EXACT 32 bytes
 // Specialized leaf node holding a single child pointer.
@@ -1,5 +1,7 @@
 package art
 
+import "math/bits"
+
 // PresenceBitmap is a compact 256-bit presence map used by some node types.
 // It is stored as four 64-bit words (little index: word 0 contains bits 0..63).
 type PresenceBitmap [4]uint64
@@ -24,3 +26,12 @@ func (p *PresenceBitmap) Clear(b byte) {
 	off := b & 0x3F
 	(*p)[word] &^= uint64(1) << off
 }
+
+// Count returns the number of set bits.
+func (p *PresenceBitmap) Count() int {
+	count := 0
+	for i := range p {
+		count += bits.OnesCount64(p[i])
+	}
+	return count
+}
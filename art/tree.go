@@ -0,0 +1,110 @@
+package art
+
+import (
+	set3 "github.com/TomTonic/Set3"
+	mm "github.com/TomTonic/multimap"
+)
+
+// Tree is an adaptive radix tree mapping Keys to sets of values. The root
+// node always has an empty prefix; the empty Key is stored as the root's value.
+//
+// Tree is not safe for concurrent use. Callers that share a Tree between
+// goroutines must provide their own synchronization.
+type Tree[T comparable] struct {
+	root *Node[T]
+	size uint64 // number of keys with at least one value
+}
+
+// NewTree returns an empty Tree.
+func NewTree[T comparable]() *Tree[T] {
+	return &Tree[T]{root: newLeafNode[T](nil).asNode()}
+}
+
+// Insert adds value to the set stored at key. If the key does not exist yet
+// it is created. Nodes along the path are split or grown as required. The
+// key bytes are copied into the tree; later changes to key do not affect it.
+func (t *Tree[T]) Insert(key mm.Key, value T) {
+	var created bool
+	t.root, created = t.root.insert(key, 0, value)
+	if created {
+		t.size++
+	}
+}
+
+// Get returns a copy of the set of values stored at key. If the key does not
+// exist, an empty set is returned. The result is never nil.
+func (t *Tree[T]) Get(key mm.Key) *set3.Set3[T] {
+	n := t.root.getChild(mm.Key{}, key)
+	if !n.holdsKey(key) {
+		return set3.Empty[T]()
+	}
+	return n.GetValues()
+}
+
+// Contains reports whether at least one value is stored at key.
+func (t *Tree[T]) Contains(key mm.Key) bool {
+	return t.root.getChild(mm.Key{}, key).holdsKey(key)
+}
+
+// LongestPrefixMatch returns the longest stored key that is a prefix of key,
+// including key itself, together with a copy of its values. It descends along
+// key like Get and remembers the deepest node on the way whose key is a
+// prefix of key. If no stored key is a prefix of key, it returns nil, an
+// empty set and false.
+func (t *Tree[T]) LongestPrefixMatch(key mm.Key) (mm.Key, *set3.Set3[T], bool) {
+	var best *Node[T]
+	n, depth := t.root, 0
+	for n != nil {
+		// like remove, only the inline part of the compressed path is compared;
+		// candidates are verified against their full key
+		l := int(n.GetPrefixLen())
+		full := n.fullPrefixLen()
+		if depth+full > len(key) || int(mm.LongestCommonPrefix(n.localPrefix[:l], key[depth:])) < l {
+			break
+		}
+		depth += full
+		if n.HasValue() && key.HasPrefix(n.value.key) {
+			best = n
+		}
+		if depth == len(key) {
+			break
+		}
+		slot := n.findChildSlot(key[depth])
+		if slot == nil {
+			break
+		}
+		n = *slot
+	}
+	if best == nil {
+		return nil, set3.EmptyWithCapacity[T](0), false
+	}
+	return best.value.key.Clone(), best.GetValues(), true
+}
+
+// Size returns the number of keys stored in the tree.
+func (t *Tree[T]) Size() uint64 {
+	return t.size
+}
+
+// Delete removes key together with all its values. Nodes along the path are
+// merged or shrunk as required. It reports whether the key existed.
+func (t *Tree[T]) Delete(key mm.Key) bool {
+	return t.remove(key, func(n *Node[T]) { n.value = nil })
+}
+
+// RemoveValue removes value from the set stored at key. If the set becomes
+// empty, the key is removed from the tree. Removing a non-existent key or
+// value is a no-op.
+func (t *Tree[T]) RemoveValue(key mm.Key, value T) {
+	t.remove(key, func(n *Node[T]) { n.RemoveValue(value) })
+}
+
+func (t *Tree[T]) remove(key mm.Key, drop func(*Node[T])) bool {
+	if !t.root.remove(key, 0, drop) {
+		return false
+	}
+	// the root keeps its empty prefix, so it is never merged or removed
+	t.root = t.root.shrink()
+	t.size--
+	return true
+}
@@ -0,0 +1,333 @@
+package art
+
+import (
+	"math/bits"
+
+	set3 "github.com/TomTonic/Set3"
+	mm "github.com/TomTonic/multimap"
+)
+
+// keyRange describes the keys visited by an ordered walk. A bound that is not
+// set leaves that side of the range open.
+type keyRange struct {
+	from, to         mm.Key
+	hasFrom, hasTo   bool
+	fromIncl, toIncl bool
+}
+
+// prefixRange returns the range of all keys starting with prefix. The upper
+// bound is the smallest key greater than all of them: prefix without its
+// trailing 0xFF bytes and with the last remaining byte incremented. If prefix
+// consists of 0xFF bytes only, the range is open at the top.
+func prefixRange(prefix mm.Key) keyRange {
+	r := keyRange{from: prefix, hasFrom: true, fromIncl: true}
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xFF {
+			r.to = append(prefix[:i:i], prefix[i]+1)
+			r.hasTo = true
+			break
+		}
+	}
+	return r
+}
+
+// walkRange calls f in ascending key order (see mm.Key.LessThan) for every key
+// in r together with the node holding its values, until f returns false. Only
+// subtrees whose key range overlaps r are visited. The key passed to f is the
+// tree's own copy and must not be modified.
+func (t *Tree[T]) walkRange(r keyRange, f func(key mm.Key, n *Node[T]) bool) {
+	t.root.walkRange(make([]byte, 0, 32), &r, !r.hasFrom, !r.hasTo, f)
+}
+
+// first returns a clone of the smallest key in r, or of the greatest one if
+// descending is set, together with a clone of its values. If r holds no key,
+// it returns nil, an empty set and false.
+func (t *Tree[T]) first(r keyRange, descending bool) (mm.Key, *set3.Set3[T], bool) {
+	var key mm.Key
+	values := set3.EmptyWithCapacity[T](0)
+	found := false
+	visit := func(k mm.Key, n *Node[T]) bool {
+		key, values, found = k.Clone(), n.GetValues(), true
+		return false
+	}
+	if descending {
+		t.walkRangeDescending(r, visit)
+	} else {
+		t.walkRange(r, visit)
+	}
+	return key, values, found
+}
+
+// walkRange visits the subtree rooted at n. path is the key of the parent of n.
+// lowerDone and upperDone report whether the whole subtree is already known to
+// satisfy the respective bound. It returns false once the walk has to stop,
+// either because f asked for it or because the upper bound was passed.
+func (n *Node[T]) walkRange(path []byte, r *keyRange, lowerDone, upperDone bool, f func(key mm.Key, n *Node[T]) bool) bool {
+	path = n.appendFullPrefixTo(path)
+	s := r.enterAscending(path, lowerDone, upperDone)
+	if s.skip || s.stop {
+		return !s.stop
+	}
+	if s.visitSelf && n.HasValue() && !f(n.value.key, n) {
+		return false
+	}
+	if !s.descend {
+		// the node was the last one in range
+		return false
+	}
+	return n.forEachChildAscending(func(c *Node[T]) bool {
+		return c.walkRange(path, r, s.lowerDone, s.upperDone, f)
+	})
+}
+
+// walkStep is the outcome of comparing the key of a node with a keyRange
+// during an ascending walk.
+type walkStep struct {
+	visitSelf, descend   bool // whether the node itself and its descendants may be in range
+	lowerDone, upperDone bool // whether the whole subtree satisfies the bound
+	skip                 bool // the subtree lies before the range
+	stop                 bool // the subtree and everything after it lies behind the range
+}
+
+// enterAscending compares path, the full key of a node, with r. lowerDone and
+// upperDone are those of the parent.
+func (r *keyRange) enterAscending(path []byte, lowerDone, upperDone bool) walkStep {
+	s := walkStep{visitSelf: true, descend: true, lowerDone: lowerDone, upperDone: upperDone}
+	if !lowerDone {
+		lcp := int(mm.LongestCommonPrefix(path, r.from))
+		switch {
+		case lcp == len(path) && lcp == len(r.from):
+			// path equals from, all descendants are greater
+			s.visitSelf = r.fromIncl
+			s.lowerDone = true
+		case lcp == len(path):
+			// path is a true prefix of from, descendants may be greater or smaller
+			s.visitSelf = false
+		case lcp == len(r.from) || path[lcp] > r.from[lcp]:
+			// path and all descendants are greater than from
+			s.lowerDone = true
+		default:
+			// path and all descendants are smaller than from
+			s.skip = true
+			return s
+		}
+	}
+
+	if !upperDone {
+		lcp := int(mm.LongestCommonPrefix(path, r.to))
+		switch {
+		case lcp == len(path) && lcp == len(r.to):
+			// path equals to, all descendants are greater
+			s.visitSelf = s.visitSelf && r.toIncl
+			s.descend = false
+		case lcp == len(path):
+			// path is a true prefix of to, descendants may be greater or smaller
+		case lcp == len(r.to) || path[lcp] > r.to[lcp]:
+			// path and everything after it in key order is greater than to
+			s.stop = true
+		default:
+			// path and all descendants are smaller than to
+			s.upperDone = true
+		}
+	}
+	return s
+}
+
+// walkRangeDescending is like walkRange but calls f in descending key order.
+func (t *Tree[T]) walkRangeDescending(r keyRange, f func(key mm.Key, n *Node[T]) bool) {
+	t.root.walkRangeDescending(make([]byte, 0, 32), &r, !r.hasFrom, !r.hasTo, f)
+}
+
+// walkRangeDescending visits the subtree rooted at n in descending key order,
+// children before n itself. The parameters are those of walkRange. It returns
+// false once the walk has to stop, either because f asked for it or because
+// the lower bound was passed.
+func (n *Node[T]) walkRangeDescending(path []byte, r *keyRange, lowerDone, upperDone bool, f func(key mm.Key, n *Node[T]) bool) bool {
+	path = n.appendFullPrefixTo(path)
+	visitSelf, descend, last := true, true, false
+
+	if !upperDone {
+		lcp := int(mm.LongestCommonPrefix(path, r.to))
+		switch {
+		case lcp == len(path) && lcp == len(r.to):
+			// path equals to, all descendants are greater
+			visitSelf = r.toIncl
+			descend = false
+		case lcp == len(path):
+			// path is a true prefix of to, descendants may be greater or smaller
+		case lcp == len(r.to) || path[lcp] > r.to[lcp]:
+			// path and all descendants are greater than to, continue with smaller keys
+			return true
+		default:
+			// path and all descendants are smaller than to
+			upperDone = true
+		}
+	}
+
+	if !lowerDone {
+		lcp := int(mm.LongestCommonPrefix(path, r.from))
+		switch {
+		case lcp == len(path) && lcp == len(r.from):
+			// path equals from, all descendants are greater
+			visitSelf = visitSelf && r.fromIncl
+			lowerDone = true
+			last = true
+		case lcp == len(path):
+			// path is a true prefix of from, descendants may be greater or smaller
+			visitSelf = false
+			last = true
+		case lcp == len(r.from) || path[lcp] > r.from[lcp]:
+			// path and all descendants are greater than from
+			lowerDone = true
+		default:
+			// path and everything after it in descending order is smaller than from
+			return false
+		}
+	}
+
+	if descend && !n.forEachChildDescending(func(c *Node[T]) bool {
+		return c.walkRangeDescending(path, r, lowerDone, upperDone, f)
+	}) {
+		return false
+	}
+	if visitSelf && n.HasValue() && !f(n.value.key, n) {
+		return false
+	}
+	// every key visited after n would be smaller than n
+	return !last
+}
+
+// appendFullPrefixTo appends the whole compressed path of n to path. Bytes that
+// are not stored inline are restored from the key of a node below n.
+func (n *Node[T]) appendFullPrefixTo(path []byte) []byte {
+	full := n.fullPrefixLen()
+	if full <= maxLocalPrefixLen {
+		return append(path, n.localPrefix[:full]...)
+	}
+	depth := len(path)
+	return append(path, n.anyKey()[depth:depth+full]...)
+}
+
+// forEachChildAscending calls f for every child of n in ascending order of
+// the key bytes until f returns false. It reports whether all calls returned
+// true.
+func (n *Node[T]) forEachChildAscending(f func(child *Node[T]) bool) bool {
+	switch n.GetNodeType() {
+	case NodeTypeLeaf:
+		if c := n.asLeaf().child; c != nil {
+			return f(c)
+		}
+	case NodeType64:
+		x := n.asNode64()
+		return forEachUnsortedChildSorted(x.firstKeyByte[:x.numChildren], x.child[:x.numChildren], false, f)
+	case NodeType128:
+		x := n.asNode128()
+		return forEachUnsortedChildSorted(x.firstKeyByte[:x.numChildren], x.child[:x.numChildren], false, f)
+	case NodeType256:
+		x := n.asNode256()
+		return forEachUnsortedChildSorted(x.firstKeyByte[:x.numChildren], x.child[:x.numChildren], false, f)
+	case NodeType512:
+		// firstKeyByte[] is sorted
+		x := n.asNode512()
+		for i := 0; i < int(x.numChildren); i++ {
+			if !f(x.child[i]) {
+				return false
+			}
+		}
+	case NodeType1024:
+		// firstKeyByte[] is sorted
+		x := n.asNode1024()
+		for i := 0; i < int(x.numChildren); i++ {
+			if !f(x.child[i]) {
+				return false
+			}
+		}
+	case FullNodeType:
+		// walk the bitmap instead of probing all 256 array slots
+		x := n.asFullNode()
+		for w := range x.bitmap {
+			for word := x.bitmap[w]; word != 0; word &= word - 1 {
+				if !f(x.child[w<<6|bits.TrailingZeros64(word)]) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// forEachChildDescending calls f for every child of n in descending order of
+// the key bytes until f returns false. It reports whether all calls returned
+// true.
+func (n *Node[T]) forEachChildDescending(f func(child *Node[T]) bool) bool {
+	switch n.GetNodeType() {
+	case NodeTypeLeaf:
+		if c := n.asLeaf().child; c != nil {
+			return f(c)
+		}
+	case NodeType64:
+		x := n.asNode64()
+		return forEachUnsortedChildSorted(x.firstKeyByte[:x.numChildren], x.child[:x.numChildren], true, f)
+	case NodeType128:
+		x := n.asNode128()
+		return forEachUnsortedChildSorted(x.firstKeyByte[:x.numChildren], x.child[:x.numChildren], true, f)
+	case NodeType256:
+		x := n.asNode256()
+		return forEachUnsortedChildSorted(x.firstKeyByte[:x.numChildren], x.child[:x.numChildren], true, f)
+	case NodeType512:
+		// firstKeyByte[] is sorted
+		x := n.asNode512()
+		for i := int(x.numChildren) - 1; i >= 0; i-- {
+			if !f(x.child[i]) {
+				return false
+			}
+		}
+	case NodeType1024:
+		// firstKeyByte[] is sorted
+		x := n.asNode1024()
+		for i := int(x.numChildren) - 1; i >= 0; i-- {
+			if !f(x.child[i]) {
+				return false
+			}
+		}
+	case FullNodeType:
+		// walk the bitmap from the highest bit down
+		x := n.asFullNode()
+		for w := len(x.bitmap) - 1; w >= 0; w-- {
+			for word := x.bitmap[w]; word != 0; {
+				bit := 63 - bits.LeadingZeros64(word)
+				if !f(x.child[w<<6|bit]) {
+					return false
+				}
+				word &^= 1 << bit
+			}
+		}
+	}
+	return true
+}
+
+// forEachUnsortedChildSorted sorts the (at most maxChildrenNode256) key bytes
+// of an unsorted node on the stack and calls f in ascending order, or in
+// descending order if descending is set.
+func forEachUnsortedChildSorted[T comparable](keyBytes []byte, children []*Node[T], descending bool, f func(child *Node[T]) bool) bool {
+	var order [maxChildrenNode256]uint8
+	for i := range keyBytes {
+		// insertion sort, the arrays are tiny
+		j := i
+		for j > 0 && keyBytes[order[j-1]] > keyBytes[i] {
+			order[j] = order[j-1]
+			j--
+		}
+		order[j] = uint8(i)
+	}
+	sorted := order[:len(keyBytes)]
+	for i := range sorted {
+		if descending {
+			i = len(sorted) - 1 - i
+		}
+		if !f(children[sorted[i]]) {
+			return false
+		}
+	}
+	return true
+}
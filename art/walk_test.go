@@ -0,0 +1,268 @@
+package art
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	mm "github.com/TomTonic/multimap"
+)
+
+// collectRange returns the keys visited by walkRange in visiting order.
+func collectRange[T comparable](tree *Tree[T], r keyRange) []mm.Key {
+	var result []mm.Key
+	tree.walkRange(r, func(k mm.Key, _ *Node[T]) bool {
+		result = append(result, k.Clone())
+		return true
+	})
+	return result
+}
+
+// filterSorted returns the keys of sorted that lie in r, using the same
+// comparisons as the array-based MultiMap.
+func filterSorted(sorted []mm.Key, r keyRange) []mm.Key {
+	var result []mm.Key
+	for _, k := range sorted {
+		if r.hasFrom && (k.LessThan(r.from) || (!r.fromIncl && k.Equal(r.from))) {
+			continue
+		}
+		if r.hasTo && (r.to.LessThan(k) || (!r.toIncl && k.Equal(r.to))) {
+			continue
+		}
+		result = append(result, k)
+	}
+	return result
+}
+
+func sortedKeys(keys map[string]bool) []mm.Key {
+	result := make([]mm.Key, 0, len(keys))
+	for k := range keys {
+		result = append(result, mm.Key(k))
+	}
+	slices.SortFunc(result, func(a, b mm.Key) int {
+		switch {
+		case a.LessThan(b):
+			return -1
+		case b.LessThan(a):
+			return 1
+		}
+		return 0
+	})
+	return result
+}
+
+func equalKeys(a, b []mm.Key) bool {
+	return slices.EqualFunc(a, b, func(x, y mm.Key) bool { return x.Equal(y) })
+}
+
+func TestTree_walkRange_emptyTree(t *testing.T) {
+	tree := NewTree[int]()
+	if got := collectRange(tree, keyRange{}); len(got) != 0 {
+		t.Fatalf("expected no keys, got %v", got)
+	}
+}
+
+func TestTree_walkRange_ascendingOrderAcrossNodeTypes(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	tree := NewTree[int]()
+	keys := map[string]bool{}
+	// wide fan-out on the first two levels produces every node type
+	for i := 0; i < 4000; i++ {
+		k := mm.Key{byte(rng.Intn(256)), byte(rng.Intn(1 + i%60))}
+		k = append(k, make(mm.Key, rng.Intn(3))...)
+		tree.Insert(k, i)
+		keys[string(k)] = true
+	}
+	tree.Insert(mm.Key{}, -1)
+	keys[""] = true
+
+	want := sortedKeys(keys)
+	if got := collectRange(tree, keyRange{}); !equalKeys(got, want) {
+		t.Fatalf("unbounded walk is not in ascending key order")
+	}
+}
+
+func TestTree_walkRange_boundsMatchFilter(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	tree := NewTree[int]()
+	keys := map[string]bool{}
+	randomKey := func() mm.Key {
+		k := make(mm.Key, rng.Intn(20))
+		for j := range k {
+			k[j] = byte(rng.Intn(5)) * 0x3F
+		}
+		return k
+	}
+	for i := 0; i < 3000; i++ {
+		k := randomKey()
+		tree.Insert(k, i)
+		keys[string(k)] = true
+	}
+	sorted := sortedKeys(keys)
+
+	for i := 0; i < 2000; i++ {
+		r := keyRange{
+			from: randomKey(), to: randomKey(),
+			hasFrom: rng.Intn(4) > 0, hasTo: rng.Intn(4) > 0,
+			fromIncl: rng.Intn(2) == 0, toIncl: rng.Intn(2) == 0,
+		}
+		if rng.Intn(4) == 0 {
+			// use stored keys as bounds to exercise the inclusive/exclusive edges
+			r.from = sorted[rng.Intn(len(sorted))]
+			r.to = sorted[rng.Intn(len(sorted))]
+		}
+		got := collectRange(tree, r)
+		want := filterSorted(sorted, r)
+		if !equalKeys(got, want) {
+			t.Fatalf("walkRange(%+v) returned %d keys, want %d", r, len(got), len(want))
+		}
+	}
+}
+
+func TestTree_walkRange_stopsEarly(t *testing.T) {
+	tree := NewTree[int]()
+	for i := 0; i < 100; i++ {
+		tree.Insert(mm.FromInt(i), i)
+	}
+	var visited []int
+	tree.walkRange(keyRange{from: mm.FromInt(10), hasFrom: true, fromIncl: true}, func(_ mm.Key, n *Node[int]) bool {
+		visited = append(visited, n.value.ToArray()[0])
+		return len(visited) < 3
+	})
+	if !slices.Equal(visited, []int{10, 11, 12}) {
+		t.Fatalf("expected to visit 10, 11, 12 and stop, got %v", visited)
+	}
+}
+
+func TestTree_walkRange_longCompressedPaths(t *testing.T) {
+	tree := NewTree[int]()
+	keys := map[string]bool{}
+	base := make(mm.Key, 3*maxLocalPrefixLen)
+	for i := range base {
+		base[i] = byte(i + 1)
+	}
+	for i := 0; i < 50; i++ {
+		k := append(base.Clone(), byte(i*5))
+		k = append(k, base...)
+		tree.Insert(k, i)
+		keys[string(k)] = true
+	}
+	sorted := sortedKeys(keys)
+	r := keyRange{from: sorted[10], to: sorted[20], hasFrom: true, hasTo: true, toIncl: true}
+	if got := collectRange(tree, r); !equalKeys(got, sorted[11:21]) {
+		t.Fatalf("range over long compressed paths returned %d keys, want 10", len(got))
+	}
+}
+
+func TestNode_forEachChildAscending_unsortedNode(t *testing.T) {
+	n := newNode64[int](nil)
+	for _, b := range []byte{9, 3, 7, 1} {
+		c := newLeafNode[int]([]byte{b})
+		n.addChild(b, c.asNode())
+	}
+	var got []byte
+	n.asNode().forEachChildAscending(func(c *Node[int]) bool {
+		got = append(got, c.localPrefix[0])
+		return true
+	})
+	if !slices.Equal(got, []byte{1, 3, 7, 9}) {
+		t.Fatalf("children visited in order %v, want [1 3 7 9]", got)
+	}
+}
+
+func TestPrefixRange(t *testing.T) {
+	tests := []struct {
+		prefix mm.Key
+		to     mm.Key
+		hasTo  bool
+	}{
+		{mm.Key{}, nil, false},
+		{mm.Key{0x01}, mm.Key{0x02}, true},
+		{mm.Key{0x01, 0xFF}, mm.Key{0x02}, true},
+		{mm.Key{0x01, 0xFE, 0xFF, 0xFF}, mm.Key{0x01, 0xFF}, true},
+		{mm.Key{0xFF, 0xFF}, nil, false},
+	}
+	for _, tc := range tests {
+		prefix := tc.prefix.Clone()
+		r := prefixRange(prefix)
+		if !r.hasFrom || !r.fromIncl || !r.from.Equal(tc.prefix) || r.hasTo != tc.hasTo || (tc.hasTo && (r.toIncl || !r.to.Equal(tc.to))) {
+			t.Fatalf("prefixRange(%v) = %+v, want upper bound %v", tc.prefix, r, tc.to)
+		}
+		if !prefix.Equal(tc.prefix) {
+			t.Fatalf("prefixRange modified its argument")
+		}
+	}
+}
+
+func TestTree_walkRangeDescending_boundsMatchFilter(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	tree := NewTree[int]()
+	keys := map[string]bool{}
+	randomKey := func() mm.Key {
+		k := make(mm.Key, rng.Intn(20))
+		for j := range k {
+			k[j] = byte(rng.Intn(5)) * 0x3F
+		}
+		return k
+	}
+	// wide fan-out below the root produces every node type
+	for i := 0; i < 3000; i++ {
+		k := append(mm.Key{byte(rng.Intn(256))}, randomKey()...)
+		tree.Insert(k, i)
+		keys[string(k)] = true
+	}
+	sorted := sortedKeys(keys)
+
+	for i := 0; i < 2000; i++ {
+		r := keyRange{
+			from: append(mm.Key{byte(rng.Intn(256))}, randomKey()...), to: append(mm.Key{byte(rng.Intn(256))}, randomKey()...),
+			hasFrom: rng.Intn(4) > 0, hasTo: rng.Intn(4) > 0,
+			fromIncl: rng.Intn(2) == 0, toIncl: rng.Intn(2) == 0,
+		}
+		if rng.Intn(4) == 0 {
+			r.from = sorted[rng.Intn(len(sorted))]
+			r.to = sorted[rng.Intn(len(sorted))]
+		}
+		var got []mm.Key
+		tree.walkRangeDescending(r, func(k mm.Key, _ *Node[int]) bool {
+			got = append(got, k.Clone())
+			return true
+		})
+		want := filterSorted(sorted, r)
+		slices.Reverse(want)
+		if !equalKeys(got, want) {
+			t.Fatalf("walkRangeDescending(%+v) returned %d keys, want %d", r, len(got), len(want))
+		}
+	}
+}
+
+func TestTree_walkRangeDescending_stopsEarly(t *testing.T) {
+	tree := NewTree[int]()
+	for i := 0; i < 100; i++ {
+		tree.Insert(mm.FromInt(i), i)
+	}
+	var visited []int
+	tree.walkRangeDescending(keyRange{to: mm.FromInt(50), hasTo: true}, func(_ mm.Key, n *Node[int]) bool {
+		visited = append(visited, n.value.ToArray()[0])
+		return len(visited) < 3
+	})
+	if !slices.Equal(visited, []int{49, 48, 47}) {
+		t.Fatalf("expected to visit 49, 48, 47 and stop, got %v", visited)
+	}
+}
+
+func TestNode_forEachChildDescending_unsortedNode(t *testing.T) {
+	n := newNode64[int](nil)
+	for _, b := range []byte{9, 3, 7, 1} {
+		c := newLeafNode[int]([]byte{b})
+		n.addChild(b, c.asNode())
+	}
+	var got []byte
+	n.asNode().forEachChildDescending(func(c *Node[int]) bool {
+		got = append(got, c.localPrefix[0])
+		return true
+	})
+	if !slices.Equal(got, []byte{9, 7, 3, 1}) {
+		t.Fatalf("children visited in order %v, want [9 7 3 1]", got)
+	}
+}
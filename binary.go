@@ -0,0 +1,395 @@
+package multimap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"iter"
+	"reflect"
+
+	set3 "github.com/TomTonic/Set3"
+)
+
+// Binary format
+// -------------
+// WriteBinary produces the following stream, all integers are unsigned
+// varints unless noted otherwise:
+//
+//	magic "MMAP" (4 bytes), version (1 byte)
+//	per key:   number of values (≥ 1), key length, key bytes,
+//	           per value: encoded length, encoded bytes
+//	end:       0
+//	checksum:  CRC-32C of everything before, 4 bytes big-endian
+//
+// Keys are written in ascending order. Keys without values are skipped,
+// since they cannot be restored through AddValue, so a value count of 0 can
+// mark the end of the entries.
+const (
+	binaryMagic   = "MMAP"
+	binaryVersion = 1
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrInvalidFormat is returned by ReadBinary when the input is not a stream
+// written by WriteBinary or is truncated.
+var ErrInvalidFormat = errors.New("multimap: invalid binary format")
+
+// ErrChecksum is returned by ReadBinary when the checksum of the input does
+// not match its contents.
+var ErrChecksum = errors.New("multimap: checksum mismatch")
+
+// ErrNoValueCodec is returned by DefaultValueCodec and by MarshalBinary and
+// UnmarshalBinary when there is no built-in ValueCodec for the value type.
+var ErrNoValueCodec = errors.New("multimap: no value codec for this type")
+
+// ValueCodec converts values of type T to bytes and back for WriteBinary and
+// ReadBinary. DecodeValue must accept every byte slice EncodeValue returns
+// and must not retain it. StringCodec, IntCodec and UintCodec implement
+// ValueCodec for their types in addition to KeyCodec.
+type ValueCodec[T any] interface {
+	EncodeValue(value T) ([]byte, error)
+	DecodeValue(p []byte) (T, error)
+}
+
+// EncodeValue returns the bytes of s.
+func (StringCodec) EncodeValue(s string) ([]byte, error) { return []byte(s), nil }
+
+// DecodeValue returns p as a string.
+func (StringCodec) DecodeValue(p []byte) (string, error) { return string(p), nil }
+
+// EncodeValue returns i as a signed varint.
+func (IntCodec[I]) EncodeValue(i I) ([]byte, error) {
+	return binary.AppendVarint(nil, int64(i)), nil
+}
+
+// DecodeValue decodes a signed varint. It returns ErrKeyOverflow if the value
+// does not fit into I.
+func (IntCodec[I]) DecodeValue(p []byte) (I, error) {
+	v, n := binary.Varint(p)
+	if n <= 0 || n != len(p) {
+		return 0, ErrInvalidFormat
+	}
+	if int64(I(v)) != v {
+		return 0, ErrKeyOverflow
+	}
+	return I(v), nil
+}
+
+// EncodeValue returns u as an unsigned varint.
+func (UintCodec[U]) EncodeValue(u U) ([]byte, error) {
+	return binary.AppendUvarint(nil, uint64(u)), nil
+}
+
+// DecodeValue decodes an unsigned varint. It returns ErrKeyOverflow if the
+// value does not fit into U.
+func (UintCodec[U]) DecodeValue(p []byte) (U, error) {
+	v, n := binary.Uvarint(p)
+	if n <= 0 || n != len(p) {
+		return 0, ErrInvalidFormat
+	}
+	if uint64(U(v)) != v {
+		return 0, ErrKeyOverflow
+	}
+	return U(v), nil
+}
+
+// DefaultValueCodec returns the built-in ValueCodec for T: StringCodec for
+// string, IntCodec or UintCodec for the predeclared integer types, and a codec
+// calling MarshalBinary and UnmarshalBinary if T implements
+// encoding.BinaryMarshaler and *T implements encoding.BinaryUnmarshaler. For
+// any other T it returns ErrNoValueCodec.
+func DefaultValueCodec[T comparable]() (ValueCodec[T], error) {
+	var codec any
+	var zero T
+	switch any(zero).(type) {
+	case string:
+		codec = StringCodec{}
+	case int:
+		codec = IntCodec[int]{}
+	case int8:
+		codec = IntCodec[int8]{}
+	case int16:
+		codec = IntCodec[int16]{}
+	case int32:
+		codec = IntCodec[int32]{}
+	case int64:
+		codec = IntCodec[int64]{}
+	case uint:
+		codec = UintCodec[uint]{}
+	case uint8:
+		codec = UintCodec[uint8]{}
+	case uint16:
+		codec = UintCodec[uint16]{}
+	case uint32:
+		codec = UintCodec[uint32]{}
+	case uint64:
+		codec = UintCodec[uint64]{}
+	case uintptr:
+		codec = UintCodec[uintptr]{}
+	default:
+		_, marshaler := any(zero).(encoding.BinaryMarshaler)
+		_, unmarshaler := any(&zero).(encoding.BinaryUnmarshaler)
+		if !marshaler || !unmarshaler {
+			return nil, fmt.Errorf("%w %v", ErrNoValueCodec, reflect.TypeFor[T]())
+		}
+		return binaryMarshalerCodec[T]{}, nil
+	}
+	return codec.(ValueCodec[T]), nil
+}
+
+// binaryMarshalerCodec is the ValueCodec for types implementing
+// encoding.BinaryMarshaler and encoding.BinaryUnmarshaler.
+type binaryMarshalerCodec[T any] struct{}
+
+func (binaryMarshalerCodec[T]) EncodeValue(v T) ([]byte, error) {
+	return any(v).(encoding.BinaryMarshaler).MarshalBinary()
+}
+
+func (binaryMarshalerCodec[T]) DecodeValue(p []byte) (T, error) {
+	var v T
+	err := any(&v).(encoding.BinaryUnmarshaler).UnmarshalBinary(p)
+	return v, err
+}
+
+// WriteBinary writes all keys and values of m to w in the format read by
+// ReadBinary, encoding values with codec. It returns the number of bytes
+// written. The MultiMap implementations of this module are read-locked for
+// the whole write, so the output is a consistent snapshot and writers block
+// until WriteBinary returns. Other implementations are read with m.All;
+// callers must stop writers to get a consistent snapshot of them.
+func WriteBinary[T comparable](w io.Writer, m MultiMap[T], codec ValueCodec[T]) (int64, error) {
+	if v, ok := m.(allViewer[T]); ok {
+		var n int64
+		err := v.ViewAll(func(all iter.Seq2[Key, *set3.Set3[T]]) error {
+			var err error
+			n, err = writeEntries(w, all, codec)
+			return err
+		})
+		return n, err
+	}
+	return writeEntries(w, m.All(), codec)
+}
+
+// allViewer is implemented by the MultiMap implementations of this module.
+// ViewAll calls f with an iterator over all entries while holding the read
+// lock.
+type allViewer[T comparable] interface {
+	ViewAll(f func(all iter.Seq2[Key, *set3.Set3[T]]) error) error
+}
+
+// writeEntries writes the entries yielded by all to w, see WriteBinary.
+func writeEntries[T comparable](w io.Writer, all iter.Seq2[Key, *set3.Set3[T]], codec ValueCodec[T]) (int64, error) {
+	cw := &checksumWriter{w: bufio.NewWriter(w), crc: crc32.New(castagnoli)}
+	cw.write(append([]byte(binaryMagic), binaryVersion))
+	var buf []byte
+	for key, values := range all {
+		if cw.err != nil {
+			break
+		}
+		if values.Size() == 0 {
+			continue
+		}
+		buf = binary.AppendUvarint(buf[:0], uint64(values.Size()))
+		buf = binary.AppendUvarint(buf, uint64(len(key)))
+		cw.write(append(buf, key...))
+		for v := range values.ImmutableRange() {
+			p, err := codec.EncodeValue(v)
+			if err != nil {
+				return cw.n, err
+			}
+			buf = binary.AppendUvarint(buf[:0], uint64(len(p)))
+			cw.write(append(buf, p...))
+		}
+	}
+	cw.write([]byte{0})
+	sum := cw.crc.Sum32()
+	cw.write(binary.BigEndian.AppendUint32(nil, sum))
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// checksumWriter writes to w and feeds all bytes into crc. After the first
+// error, writes are skipped.
+type checksumWriter struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+	n   int64
+	err error
+}
+
+func (cw *checksumWriter) write(p []byte) {
+	if cw.err != nil {
+		return
+	}
+	cw.crc.Write(p)
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+// ReadBinary reads a stream written by WriteBinary from r, decodes the values
+// with codec and adds all keys and values to m. It returns the number of
+// bytes read. The whole stream is read and its checksum verified before m is
+// modified, so m is left unchanged if ReadBinary returns an error. It returns
+// ErrInvalidFormat for malformed or truncated input and ErrChecksum if the
+// checksum does not match. ReadBinary reads r through a buffer and may consume
+// bytes after the end of the stream.
+func ReadBinary[T comparable](r io.Reader, m MultiMap[T], codec ValueCodec[T]) (int64, error) {
+	cr := &checksumReader{r: bufio.NewReader(r), crc: crc32.New(castagnoli)}
+	entries, err := readEntries(cr, codec)
+	if err != nil {
+		return cr.n, err
+	}
+	addEntries(m, entries)
+	return cr.n, nil
+}
+
+// binaryEntry is a key and its values decoded by readEntries.
+type binaryEntry[T any] struct {
+	key    Key
+	values []T
+}
+
+// readEntries decodes a whole stream and verifies its checksum.
+func readEntries[T any](cr *checksumReader, codec ValueCodec[T]) ([]binaryEntry[T], error) {
+	header, err := cr.bytes(uint64(len(binaryMagic) + 1))
+	if err != nil || string(header[:len(binaryMagic)]) != binaryMagic {
+		return nil, ErrInvalidFormat
+	}
+	if header[len(binaryMagic)] != binaryVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidFormat, header[len(binaryMagic)])
+	}
+	var entries []binaryEntry[T]
+	for {
+		count, err := cr.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			break
+		}
+		keyLen, err := cr.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		key, err := cr.bytes(keyLen)
+		if err != nil {
+			return nil, err
+		}
+		e := binaryEntry[T]{key: key}
+		for ; count > 0; count-- {
+			valueLen, err := cr.uvarint()
+			if err != nil {
+				return nil, err
+			}
+			p, err := cr.bytes(valueLen)
+			if err != nil {
+				return nil, err
+			}
+			v, err := codec.DecodeValue(p)
+			if err != nil {
+				return nil, err
+			}
+			e.values = append(e.values, v)
+		}
+		entries = append(entries, e)
+	}
+	want := cr.crc.Sum32()
+	sum, err := cr.bytes(4)
+	if err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(sum) != want {
+		return nil, ErrChecksum
+	}
+	return entries, nil
+}
+
+// addEntries adds all decoded keys and values to m.
+func addEntries[T comparable](m MultiMap[T], entries []binaryEntry[T]) {
+	for _, e := range entries {
+		for _, v := range e.values {
+			m.AddValue(e.key, v)
+		}
+	}
+}
+
+// checksumReader reads from r and feeds all bytes into crc.
+type checksumReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	n   int64
+}
+
+func (cr *checksumReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.crc.Write([]byte{b})
+		cr.n++
+	}
+	return b, err
+}
+
+// uvarint reads an unsigned varint.
+func (cr *checksumReader) uvarint() (uint64, error) {
+	v, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return 0, ErrInvalidFormat
+	}
+	return v, nil
+}
+
+// bytes reads the next n bytes. Large lengths are read incrementally, so a
+// corrupted length fails at the end of the input instead of allocating n
+// bytes up front.
+func (cr *checksumReader) bytes(n uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	read, err := io.CopyN(io.MultiWriter(&buf, cr.crc), cr.r, int64(min(n, 1<<62)))
+	cr.n += read
+	if err != nil || uint64(read) != n {
+		return nil, ErrInvalidFormat
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalBinary returns the WriteBinary encoding of m, with values encoded by
+// the DefaultValueCodec for T. Both MultiMap implementations of this module
+// implement encoding.BinaryMarshaler with it.
+func MarshalBinary[T comparable](m MultiMap[T]) ([]byte, error) {
+	codec, err := DefaultValueCodec[T]()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	_, err = WriteBinary(&buf, m, codec)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary adds the keys and values encoded in data by MarshalBinary
+// to m. Unlike ReadBinary it requires data to end right after the checksum.
+// If data is invalid, m is left unchanged.
+func UnmarshalBinary[T comparable](data []byte, m MultiMap[T]) error {
+	codec, err := DefaultValueCodec[T]()
+	if err != nil {
+		return err
+	}
+	cr := &checksumReader{r: bufio.NewReader(bytes.NewReader(data)), crc: crc32.New(castagnoli)}
+	entries, err := readEntries(cr, codec)
+	if err != nil {
+		return err
+	}
+	if cr.n != int64(len(data)) {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidFormat, int64(len(data))-cr.n)
+	}
+	addEntries(m, entries)
+	return nil
+}
@@ -0,0 +1,113 @@
+package multimap
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"strconv"
+	"testing"
+
+	set3 "github.com/TomTonic/Set3"
+)
+
+func TestWriteReadBinaryRoundTrip(t *testing.T) {
+	m := New[string]()
+	m.AddValue(FromString("a"), "x")
+	m.AddValue(FromString("a"), "")
+	m.AddValue(Key{}, "empty key")
+	m.AddValue(FromInt64(-7), "y")
+	m.AddValue(FromString("gone"), "z")
+	m.RemoveValue(FromString("gone"), "z")
+
+	var buf bytes.Buffer
+	n, err := WriteBinary(&buf, m, StringCodec{})
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteBinary() = %d, %v; buffer holds %d bytes", n, err, buf.Len())
+	}
+	loaded := New[string]()
+	if n, err := ReadBinary(bytes.NewReader(buf.Bytes()), loaded, StringCodec{}); err != nil || n != int64(buf.Len()) {
+		t.Fatalf("ReadBinary() = %d, %v", n, err)
+	}
+	if loaded.NumberOfKeys() != 3 || loaded.ContainsKey(FromString("gone")) {
+		t.Fatalf("expected the 3 keys with values, got %v", loaded.AllKeys())
+	}
+	if !loaded.ValuesFor(FromString("a")).Equals(set3.From("x", "")) || !loaded.ValuesFor(Key{}).Equals(set3.From("empty key")) {
+		t.Fatalf("values were not restored")
+	}
+}
+
+func TestReadBinaryRejectsCorruptInput(t *testing.T) {
+	m := New[int]()
+	for i := range 100 {
+		m.AddValue(FromInt(i%10), i)
+	}
+	data, err := MarshalBinary(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := bytes.Clone(data)
+	flipped[len(flipped)/2] ^= 0x10
+	badVersion := bytes.Clone(data)
+	badVersion[4] = 99
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"flipped bit", flipped, ErrChecksum},
+		{"truncated", data[:len(data)-3], ErrInvalidFormat},
+		{"empty", nil, ErrInvalidFormat},
+		{"wrong magic", []byte("JSON{}"), ErrInvalidFormat},
+		{"unknown version", badVersion, ErrInvalidFormat},
+		{"trailing bytes", append(bytes.Clone(data), 0), ErrInvalidFormat},
+	}
+	for _, tc := range tests {
+		target := New[int]()
+		target.AddValue(FromString("keep"), 1)
+		if err := UnmarshalBinary(tc.data, target); !errors.Is(err, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+		if target.NumberOfKeys() != 1 {
+			t.Fatalf("%s: the target map was modified despite the error", tc.name)
+		}
+	}
+}
+
+// decimal is a value type that implements the binary marshaling interfaces.
+type decimal struct{ cents int64 }
+
+func (d decimal) MarshalBinary() ([]byte, error) { return []byte(strconv.FormatInt(d.cents, 10)), nil }
+
+func (d *decimal) UnmarshalBinary(p []byte) (err error) {
+	d.cents, err = strconv.ParseInt(string(p), 10, 64)
+	return err
+}
+
+func TestDefaultValueCodec(t *testing.T) {
+	if _, err := DefaultValueCodec[struct{ a int }](); !errors.Is(err, ErrNoValueCodec) {
+		t.Fatalf("expected ErrNoValueCodec for a plain struct, got %v", err)
+	}
+	for _, v := range []int8{-128, 0, 127} {
+		codec, _ := DefaultValueCodec[int8]()
+		p, _ := codec.EncodeValue(v)
+		if got, err := codec.DecodeValue(p); err != nil || got != v {
+			t.Fatalf("int8 codec round trip of %d = %d, %v", v, got, err)
+		}
+	}
+
+	m := New[decimal]()
+	m.AddValue(FromString("price"), decimal{1999})
+	var marshaler encoding.BinaryMarshaler = m.(encoding.BinaryMarshaler)
+	data, err := marshaler.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := New[decimal]()
+	if err := loaded.(encoding.BinaryUnmarshaler).UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.ValuesFor(FromString("price")).Equals(set3.From(decimal{1999})) {
+		t.Fatalf("BinaryMarshaler values were not restored")
+	}
+}
@@ -0,0 +1,139 @@
+package multimap
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// KeyCodec converts values of type K to Keys and back. Encode must preserve
+// the order the caller expects for K, since range queries and iteration
+// follow the byte-wise order of the encoded Keys. Decode must accept every
+// Key that Encode produces. A KeyCodec must be safe for concurrent use; the
+// built-in codecs are stateless.
+type KeyCodec[K any] interface {
+	Encode(key K) Key
+	Decode(key Key) (K, error)
+}
+
+// ErrKeyOverflow is returned when a Key decodes to an integer that does not
+// fit into the requested integer type.
+var ErrKeyOverflow = errors.New("multimap: key value overflows the requested type")
+
+// StringCodec encodes strings with FromString and decodes them with
+// Key.StringValue. Strings are normalized to NFC, so a decoded string may
+// differ from the encoded one in its byte representation.
+type StringCodec struct{}
+
+// Encode returns FromString(s).
+func (StringCodec) Encode(s string) Key { return FromString(s) }
+
+// Decode returns k.StringValue().
+func (StringCodec) Decode(k Key) (string, error) { return k.StringValue() }
+
+// BytesCodec encodes byte slices with FromBytes and decodes them with
+// Key.Bytes.
+type BytesCodec struct{}
+
+// Encode returns FromBytes(b).
+func (BytesCodec) Encode(b []byte) Key { return FromBytes(b) }
+
+// Decode returns k.Bytes().
+func (BytesCodec) Decode(k Key) ([]byte, error) { return k.Bytes(), nil }
+
+// signed and unsigned are the integer types supported by IntCodec and
+// UintCodec.
+type (
+	signed interface {
+		~int | ~int8 | ~int16 | ~int32 | ~int64
+	}
+	unsigned interface {
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+	}
+)
+
+// IntCodec encodes any signed integer type like FromInt64, so keys of all
+// widths share one order. Decode returns ErrKeyOverflow if the decoded value
+// does not fit into I.
+type IntCodec[I signed] struct{}
+
+// Encode returns FromInt64(int64(i)).
+func (IntCodec[I]) Encode(i I) Key { return FromInt64(int64(i)) }
+
+// Decode decodes k with Key.Int64 and converts the result to I.
+func (IntCodec[I]) Decode(k Key) (I, error) {
+	v, err := k.Int64()
+	if err != nil {
+		return 0, err
+	}
+	if int64(I(v)) != v {
+		return 0, ErrKeyOverflow
+	}
+	return I(v), nil
+}
+
+// UintCodec encodes any unsigned integer type as a plain 8-byte big-endian
+// uint64, so keys of all widths share one order. Unlike FromUint64 it adds no
+// offset, which would wrap values of 1<<63 and above below the small ones.
+// Decode returns ErrKeyLength if k is not 8 bytes long and ErrKeyOverflow if
+// the decoded value does not fit into U.
+type UintCodec[U unsigned] struct{}
+
+// Encode returns uint64(u) as an 8-byte big-endian Key.
+func (UintCodec[U]) Encode(u U) Key {
+	return binary.BigEndian.AppendUint64(make(Key, 0, 8), uint64(u))
+}
+
+// Decode decodes an 8-byte big-endian uint64 and converts it to U.
+func (UintCodec[U]) Decode(k Key) (U, error) {
+	v, err := k.uint64Bits()
+	if err != nil {
+		return 0, err
+	}
+	if uint64(U(v)) != v {
+		return 0, ErrKeyOverflow
+	}
+	return U(v), nil
+}
+
+// Float64Codec encodes float64 values with FromFloat64 and decodes them with
+// Key.Float64.
+type Float64Codec struct{}
+
+// Encode returns FromFloat64(f).
+func (Float64Codec) Encode(f float64) Key { return FromFloat64(f) }
+
+// Decode returns k.Float64().
+func (Float64Codec) Decode(k Key) (float64, error) { return k.Float64() }
+
+// TimeCodec encodes times with FromTime and decodes them with Key.Time, so
+// decoded times are in UTC and carry no monotonic clock reading.
+type TimeCodec struct{}
+
+// Encode returns FromTime(t).
+func (TimeCodec) Encode(t time.Time) Key { return FromTime(t) }
+
+// Decode returns k.Time().
+func (TimeCodec) Decode(k Key) (time.Time, error) { return k.Time() }
+
+// DurationCodec encodes durations with FromDuration and decodes them with
+// Key.Duration.
+type DurationCodec struct{}
+
+// Encode returns FromDuration(d).
+func (DurationCodec) Encode(d time.Duration) Key { return FromDuration(d) }
+
+// Decode returns k.Duration().
+func (DurationCodec) Decode(k Key) (time.Duration, error) { return k.Duration() }
+
+// TupleCodec encodes tuples with FromTuple and decodes them with Key.Tuple.
+// Like FromTuple, Encode panics on unsupported element types. Decoding
+// normalizes element types as described for Key.Tuple, for example all
+// integers and times decode to int64.
+type TupleCodec struct{}
+
+// Encode returns FromTuple(t...).
+func (TupleCodec) Encode(t Tuple) Key { return FromTuple(t...) }
+
+// Decode returns k.Tuple().
+func (TupleCodec) Decode(k Key) (Tuple, error) { return k.Tuple() }
@@ -0,0 +1,71 @@
+package multimap
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCodecsRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	checks := []struct {
+		name string
+		ok   bool
+	}{
+		{"string", roundTrips[string](StringCodec{}, "héllo")},
+		{"bytes", roundTrips[[]byte](BytesCodec{}, []byte{0, 1, 0xFF})},
+		{"int", roundTrips[int](IntCodec[int]{}, math.MinInt)},
+		{"int8", roundTrips[int8](IntCodec[int8]{}, -128)},
+		{"uint16", roundTrips[uint16](UintCodec[uint16]{}, 65535)},
+		{"uint64", roundTrips[uint64](UintCodec[uint64]{}, math.MaxUint64)},
+		{"float64", roundTrips[float64](Float64Codec{}, -1.5)},
+		{"time", roundTrips[time.Time](TimeCodec{}, ts)},
+		{"duration", roundTrips[time.Duration](DurationCodec{}, -time.Minute)},
+		{"tuple", roundTrips[Tuple](TupleCodec{}, Tuple{"a", int64(1), 2.5})},
+	}
+	for _, c := range checks {
+		if !c.ok {
+			t.Fatalf("%s codec does not round-trip", c.name)
+		}
+	}
+}
+
+func roundTrips[K any](codec KeyCodec[K], key K) bool {
+	got, err := codec.Decode(codec.Encode(key))
+	return err == nil && reflect.DeepEqual(got, key)
+}
+
+func TestUintCodecPreservesOrder(t *testing.T) {
+	c := UintCodec[uint64]{}
+	for _, pair := range [][2]uint64{{0, 1}, {1, math.MaxUint64}, {1<<63 - 1, 1 << 63}, {1 << 63, math.MaxUint64}} {
+		if !c.Encode(pair[0]).LessThan(c.Encode(pair[1])) {
+			t.Fatalf("Encode(%d) should sort before Encode(%d)", pair[0], pair[1])
+		}
+	}
+	if !(UintCodec[uint]{}).Encode(1).LessThan((UintCodec[uint]{}).Encode(math.MaxUint)) {
+		t.Fatalf("UintCodec[uint] should keep the order of large values")
+	}
+}
+
+func TestIntCodecsMatchKeyConstructors(t *testing.T) {
+	if !(IntCodec[int16]{}).Encode(-3).Equal(FromInt16(-3)) {
+		t.Fatalf("IntCodec should encode like the integer key constructors")
+	}
+	if !(UintCodec[uint32]{}).Encode(7).Equal(Key{0, 0, 0, 0, 0, 0, 0, 7}) {
+		t.Fatalf("UintCodec should encode plain big-endian")
+	}
+	if _, err := (IntCodec[int8]{}).Decode(FromInt64(200)); !errors.Is(err, ErrKeyOverflow) {
+		t.Fatalf("expected ErrKeyOverflow for 200 as int8, got %v", err)
+	}
+	if _, err := (UintCodec[uint8]{}).Decode((UintCodec[uint64]{}).Encode(256)); !errors.Is(err, ErrKeyOverflow) {
+		t.Fatalf("expected ErrKeyOverflow for 256 as uint8, got %v", err)
+	}
+	if _, err := (UintCodec[uint]{}).Decode(FromString("abc")); !errors.Is(err, ErrKeyLength) {
+		t.Fatalf("expected ErrKeyLength for a string key, got %v", err)
+	}
+	if _, err := (IntCodec[int]{}).Decode(FromString("abc")); !errors.Is(err, ErrKeyLength) {
+		t.Fatalf("expected ErrKeyLength for a string key, got %v", err)
+	}
+}
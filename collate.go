@@ -0,0 +1,60 @@
+package multimap
+
+import (
+	"sync"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// FromStringCollated returns the collation sort key of s for the language
+// tag, so that byte-wise Key order matches the order a user of that language
+// expects, for example "ä" next to "a" in German but after "z" in Swedish.
+// Options make the key insensitive to some differences: with
+// collate.IgnoreCase, "apple" and "Apple" yield the same Key, and with
+// collate.Loose, which ignores case, accents and width, so do "resume" and
+// "Résumé".
+//
+// Sort keys cannot be decoded back into the string. Keys built for different
+// tags or options are not comparable with each other or with FromString keys.
+// Every call sets up a new collator; use NewCollator to build many keys with
+// the same settings.
+func FromStringCollated(s string, tag language.Tag, options ...collate.Option) Key {
+	return NewCollator(tag, options...).Key(s)
+}
+
+// Collator builds collation sort keys like FromStringCollated for a fixed
+// language tag and set of options. It is safe for concurrent use.
+type Collator struct {
+	mu  sync.Mutex
+	c   *collate.Collator
+	buf collate.Buffer
+}
+
+// NewCollator returns a Collator for the language tag and options.
+func NewCollator(tag language.Tag, options ...collate.Option) *Collator {
+	return &Collator{c: collate.New(tag, options...)}
+}
+
+// Key returns the collation sort key of s.
+func (c *Collator) Key(s string) Key {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// the buffer is reused, the returned slice must be copied
+	k := FromBytes(c.c.KeyFromString(&c.buf, s))
+	c.buf.Reset()
+	return k
+}
+
+// FromStringFolded returns a Key for s that ignores case and compatibility
+// differences: s is case folded and normalized to Unicode NFKC, so "Apple",
+// "APPLE" and "apple" as well as "ﬁle" and "file" yield the same Key. Unlike
+// FromStringCollated the result is still the UTF-8 encoding of a string,
+// ordered byte-wise, and can be decoded with StringValue.
+func FromStringFolded(s string) Key {
+	// normalizing before folding makes sure compatibility characters are folded
+	// too, normalizing afterwards recomposes what folding decomposed
+	return FromBytes([]byte(norm.NFKC.String(cases.Fold().String(norm.NFKC.String(s)))))
+}
@@ -0,0 +1,74 @@
+package multimap
+
+import (
+	"sync"
+	"testing"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+func TestFromStringCollatedFollowsLanguageRules(t *testing.T) {
+	// German sorts "ä" with "a", Swedish sorts it after "z"
+	if !FromStringCollated("ähnlich", language.German).LessThan(FromStringCollated("zebra", language.German)) {
+		t.Fatalf("German collation should sort ähnlich before zebra")
+	}
+	if !FromStringCollated("zebra", language.Swedish).LessThan(FromStringCollated("ähnlich", language.Swedish)) {
+		t.Fatalf("Swedish collation should sort zebra before ähnlich")
+	}
+	// byte-wise, "Zebra" sorts before "apple"
+	if !FromStringCollated("apple", language.English).LessThan(FromStringCollated("Zebra", language.English)) {
+		t.Fatalf("English collation should sort apple before Zebra")
+	}
+}
+
+func TestFromStringCollatedOptions(t *testing.T) {
+	if FromStringCollated("apple", language.English).Equal(FromStringCollated("Apple", language.English)) {
+		t.Fatalf("without options, case should be significant")
+	}
+	if !FromStringCollated("apple", language.English, collate.IgnoreCase).Equal(FromStringCollated("Apple", language.English, collate.IgnoreCase)) {
+		t.Fatalf("with IgnoreCase, apple and Apple should yield the same key")
+	}
+	if !FromStringCollated("resume", language.English, collate.Loose).Equal(FromStringCollated("Résumé", language.English, collate.Loose)) {
+		t.Fatalf("with Loose, resume and Résumé should yield the same key")
+	}
+}
+
+func TestCollatorConcurrentUse(t *testing.T) {
+	c := NewCollator(language.German, collate.IgnoreCase)
+	want := c.Key("Müller")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if !c.Key("müller").Equal(want) {
+					t.Errorf("concurrent Key calls returned different keys")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if !want.Equal(FromStringCollated("MÜLLER", language.German, collate.IgnoreCase)) {
+		t.Fatalf("Collator and FromStringCollated should agree")
+	}
+}
+
+func TestFromStringFolded(t *testing.T) {
+	for _, s := range []string{"APPLE", "Apple", "apple"} {
+		if !FromStringFolded(s).Equal(FromString("apple")) {
+			t.Fatalf("FromStringFolded(%q) should equal the key of apple", s)
+		}
+	}
+	if !FromStringFolded("ﬁle").Equal(FromStringFolded("FILE")) {
+		t.Fatalf("compatibility characters should be folded")
+	}
+	if !FromStringFolded("STRASSE").Equal(FromStringFolded("straße")) {
+		t.Fatalf("full case folding should map ß to ss")
+	}
+	if s, err := FromStringFolded("Äpfel").StringValue(); err != nil || s != "äpfel" {
+		t.Fatalf("folded keys should decode as strings, got %q, %v", s, err)
+	}
+}
@@ -0,0 +1,79 @@
+package multimap
+
+import "errors"
+
+// Descending key encoding
+// -----------------------
+// Key.Descending inverts every byte, so greater bytes sort first. Inversion
+// alone would keep a key before all keys it is a prefix of, so the result is
+// terminated by 0xFF 0xFF, which sorts after every continuation. The original
+// byte 0x00 inverts to 0xFF and is escaped as 0xFF 0xFE to keep it apart from
+// the terminator. The encoding is therefore prefix-free and other bytes can be
+// appended to a descending key without changing its order.
+const (
+	descendingEscape     byte = 0xFF
+	descendingZero       byte = 0xFE
+	descendingTerminator byte = 0xFF
+)
+
+// ErrInvalidDescending is returned by Key.Ascending when a Key was not
+// produced by Key.Descending.
+var ErrInvalidDescending = errors.New("multimap: key is not a descending key")
+
+// Descending returns a Key that sorts in the reverse order of k: if a is less
+// than b, a.Descending() is greater than b.Descending(). Storing
+// FromTime(t).Descending() makes the newest entries come first. The result is
+// 2 bytes longer than k plus one byte for every 0x00 in k. Use
+// KeyBuilder.AddDescending to make one element of a composite key descending
+// while the others ascend, and Key.Ascending to decode the result.
+func (k Key) Descending() Key {
+	result := make(Key, 0, len(k)+2)
+	return appendDescending(result, k)
+}
+
+// Ascending undoes Descending and returns the original Key. It returns
+// ErrInvalidDescending if k was not produced by Descending.
+func (k Key) Ascending() (Key, error) {
+	original, n, err := readDescending(k)
+	if err == nil && n != len(k) {
+		err = ErrInvalidDescending
+	}
+	return original, err
+}
+
+// appendDescending appends the descending encoding of k to dst.
+func appendDescending(dst, k []byte) []byte {
+	for _, c := range k {
+		if c == 0 {
+			dst = append(dst, descendingEscape, descendingZero)
+		} else {
+			dst = append(dst, ^c)
+		}
+	}
+	return append(dst, descendingEscape, descendingTerminator)
+}
+
+// readDescending decodes the descending key at the start of p. It returns the
+// original key and the number of bytes of p it occupied.
+func readDescending(p []byte) (Key, int, error) {
+	result := Key{}
+	for i := 0; i < len(p); i++ {
+		if p[i] != descendingEscape {
+			result = append(result, ^p[i])
+			continue
+		}
+		if i+1 == len(p) {
+			break
+		}
+		switch p[i+1] {
+		case descendingTerminator:
+			return result, i + 2, nil
+		case descendingZero:
+			result = append(result, 0)
+			i++
+		default:
+			return nil, 0, ErrInvalidDescending
+		}
+	}
+	return nil, 0, ErrInvalidDescending
+}
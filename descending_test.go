@@ -0,0 +1,53 @@
+package multimap
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestDescendingReversesOrder(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	randomKey := func() Key {
+		k := make(Key, rng.Intn(4))
+		for i := range k {
+			k[i] = []byte{0x00, 0x01, 0x7F, 0xFE, 0xFF}[rng.Intn(5)]
+		}
+		return k
+	}
+	for i := 0; i < 5000; i++ {
+		a, b := randomKey(), randomKey()
+		if got, want := a.Descending().Compare(b.Descending()), b.Compare(a); got != want {
+			t.Fatalf("%v vs %v: descending order %d, want %d", a, b, got, want)
+		}
+	}
+}
+
+func TestDescendingPrefixAndComposition(t *testing.T) {
+	if !FromString("abc").Descending().LessThan(FromString("ab").Descending()) {
+		t.Fatalf("a longer key should sort before its prefix when descending")
+	}
+	if !FromString("ab\x00").Descending().LessThan(FromString("ab").Descending()) {
+		t.Fatalf("a key ending in 0x00 should sort before its prefix when descending")
+	}
+	// the encoding is prefix-free, so appended bytes never change the order
+	newer := append(FromInt64(200).Descending(), 0x00)
+	older := append(FromInt64(100).Descending(), 0xFF)
+	if !newer.LessThan(older) {
+		t.Fatalf("bytes appended to descending keys should not affect their order")
+	}
+}
+
+func TestDescendingRoundTrip(t *testing.T) {
+	for _, k := range []Key{{}, {0}, {0, 0}, {0xFF}, FromInt64(-3), FromString("abc")} {
+		got, err := k.Descending().Ascending()
+		if err != nil || !got.Equal(k) {
+			t.Fatalf("Ascending(Descending(%v)) = %v, %v", k, got, err)
+		}
+	}
+	for _, k := range []Key{{}, {0x01}, {0xFF}, {0xFF, 0x01}, {0xFF, 0xFF, 0x00}} {
+		if _, err := k.Ascending(); !errors.Is(err, ErrInvalidDescending) {
+			t.Fatalf("Ascending(%v): expected ErrInvalidDescending, got %v", k, err)
+		}
+	}
+}
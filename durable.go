@@ -0,0 +1,640 @@
+package multimap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	set3 "github.com/TomTonic/Set3"
+)
+
+// Write-ahead log format
+// ----------------------
+// The log is a sequence of records. Every record has a 12-byte header, the
+// payload length, the CRC-32C of the payload and the CRC-32C of the first 8
+// header bytes, all 4 bytes big-endian, followed by the payload: an operation byte, then for all operations but
+// Clear the key length as unsigned varint and the key, and for AddValue and
+// RemoveValue the value length as unsigned varint and the value encoded by
+// the ValueCodec.
+//
+// Every operation sets the presence of a value at a key regardless of the
+// previous state, so replaying the log on a snapshot that already contains
+// some of its operations yields the same map. This makes it safe to crash
+// between writing a snapshot and truncating the log.
+const (
+	durableSnapshotFile = "snapshot"
+	durableLogFile      = "wal"
+	durableTempSuffix   = ".tmp"
+
+	walAddValue    byte = 1
+	walRemoveValue byte = 2
+	walRemoveKey   byte = 3
+	walClear       byte = 4
+
+	walHeaderSize = 12
+)
+
+// SyncPolicy selects when a Durable flushes its log to stable storage.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs the log after every record, so every mutation that has
+	// returned survives a crash of the machine. It is the default.
+	SyncAlways SyncPolicy = iota
+	// SyncPeriodic syncs the log every DurableOptions.SyncInterval from a
+	// background goroutine if it was written to since the last sync. The
+	// goroutine runs until Close. Mutations of the last interval may be lost
+	// when the machine crashes, but not when only the process does.
+	SyncPeriodic
+	// SyncNever leaves syncing to the operating system and to explicit calls
+	// of Durable.Sync, Snapshot and Close.
+	SyncNever
+)
+
+// DurableOptions configures a Durable.
+type DurableOptions struct {
+	Sync         SyncPolicy
+	SyncInterval time.Duration // used with SyncPeriodic, must be positive
+}
+
+// ErrClosed is returned by the mutating methods of a Durable after Close.
+var ErrClosed = errors.New("multimap: durable map is closed")
+
+// Durable is a MultiMap that records every mutation in a write-ahead log
+// before applying it to an in-memory MultiMap, so the map can be recovered
+// after a crash. OpenDurable restores the map from the directory holding the
+// log and the latest snapshot; Snapshot writes the whole map and truncates
+// the log.
+//
+// Reads go directly to the in-memory map, which is not accessible otherwise,
+// so every mutation passes through the log. AddValue, RemoveValue, RemoveKey,
+// Clear, PopFirst and PopLast write to the log first and are not applied if
+// the write fails. Since the MultiMap methods cannot return errors, the first
+// failure is kept and returned by Err; all later mutations are rejected. A
+// Durable is safe for concurrent use; mutations are serialized.
+type Durable[T comparable] struct {
+	m MultiMap[T]
+
+	mu    sync.Mutex
+	dir   string
+	codec ValueCodec[T]
+	opts  DurableOptions
+	log   *os.File
+	dirty bool          // the log was written to since the last sync
+	stop  chan struct{} // closed by Close to end syncPeriodically
+	err   error
+}
+
+// OpenDurable opens the durable map stored in dir, creating dir if it does
+// not exist. It loads the snapshot into m, which should be empty, and replays
+// the log on top of it. Values are encoded with codec. A record at the end of
+// the log that is incomplete or fails its checksum, as left behind by a
+// crash during a write, is discarded. A damaged record followed by further
+// records cannot stem from a crash; OpenDurable returns ErrChecksum for it
+// and leaves the log unchanged.
+func OpenDurable[T comparable](dir string, m MultiMap[T], codec ValueCodec[T], opts DurableOptions) (*Durable[T], error) {
+	if opts.Sync == SyncPeriodic && opts.SyncInterval <= 0 {
+		return nil, errors.New("multimap: SyncPeriodic needs a positive SyncInterval")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	d := &Durable[T]{m: m, dir: dir, codec: codec, opts: opts}
+	snapshot := filepath.Join(dir, durableSnapshotFile)
+	// a temporary snapshot is left behind by a crash before its rename
+	if err := os.Remove(snapshot + durableTempSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if f, err := os.Open(snapshot); err == nil {
+		_, err = ReadBinary(f, m, codec)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("multimap: reading snapshot: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	log, err := os.OpenFile(filepath.Join(dir, durableLogFile), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := d.replay(log)
+	if err == nil {
+		err = log.Truncate(valid)
+	}
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+	d.log = log
+	if opts.Sync == SyncPeriodic {
+		d.stop = make(chan struct{})
+		go d.syncPeriodically()
+	}
+	return d, nil
+}
+
+// syncPeriodically implements SyncPeriodic until stop is closed.
+func (d *Durable[T]) syncPeriodically() {
+	ticker := time.NewTicker(d.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.mu.Lock()
+			if d.err == nil && d.dirty {
+				d.err = d.syncLocked()
+			}
+			d.mu.Unlock()
+		}
+	}
+}
+
+// replay applies all intact records of the log to the map and returns the
+// length of the intact part. A damaged record is only discarded as torn if
+// nothing but zero bytes follows it, since a crash can only damage the last
+// record; otherwise replay returns ErrChecksum instead of dropping the intact
+// records after it.
+func (d *Durable[T]) replay(log *os.File) (int64, error) {
+	info, err := log.Stat()
+	if err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(log)
+	var valid int64
+	header := make([]byte, walHeaderSize)
+	damaged := func() (int64, error) {
+		if zero, err := onlyZeros(r); err != nil || !zero {
+			if err == nil {
+				err = fmt.Errorf("%w: damaged log record at offset %d is followed by more records", ErrChecksum, valid)
+			}
+			return 0, err
+		}
+		return valid, nil
+	}
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				// the end of the log, or a header cut short by it
+				return valid, nil
+			}
+			return 0, err
+		}
+		if crc32.Checksum(header[:8], castagnoli) != binary.BigEndian.Uint32(header[8:]) {
+			// the length cannot be trusted, so neither can the position of
+			// the next record
+			return damaged()
+		}
+		n := int64(binary.BigEndian.Uint32(header))
+		if n == 0 {
+			// never written, every record has an operation byte
+			return damaged()
+		}
+		if valid+walHeaderSize+n > info.Size() {
+			// a record cut short by the end of the file
+			return valid, nil
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return valid, nil
+			}
+			return 0, err
+		}
+		if crc32.Checksum(payload, castagnoli) != binary.BigEndian.Uint32(header[4:]) {
+			return damaged()
+		}
+		if err := d.apply(payload); err != nil {
+			return 0, fmt.Errorf("multimap: replaying log at offset %d: %w", valid, err)
+		}
+		valid += int64(walHeaderSize + len(payload))
+	}
+}
+
+// onlyZeros reports whether r holds nothing but zero bytes until its end, as
+// left behind by file systems that extend a file before writing its data.
+func onlyZeros(r io.Reader) (bool, error) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false, nil
+			}
+		}
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// apply decodes the payload of a record and applies it to the map. A payload
+// that passed its checksum but cannot be decoded is not a torn write, so it
+// is reported instead of discarded.
+func (d *Durable[T]) apply(payload []byte) error {
+	op, rest := payload[0], payload[1:]
+	if op == walClear {
+		d.m.Clear()
+		return nil
+	}
+	key, rest, ok := readLengthPrefixed(rest)
+	if !ok {
+		return ErrInvalidFormat
+	}
+	if op == walRemoveKey {
+		d.m.RemoveKey(key)
+		return nil
+	}
+	p, _, ok := readLengthPrefixed(rest)
+	if !ok || (op != walAddValue && op != walRemoveValue) {
+		return ErrInvalidFormat
+	}
+	v, err := d.codec.DecodeValue(p)
+	if err != nil {
+		return err
+	}
+	if op == walAddValue {
+		d.m.AddValue(key, v)
+	} else {
+		d.m.RemoveValue(key, v)
+	}
+	return nil
+}
+
+// readLengthPrefixed splits a varint length prefixed byte slice off p.
+func readLengthPrefixed(p []byte) (data, rest []byte, ok bool) {
+	n, size := binary.Uvarint(p)
+	if size <= 0 || uint64(len(p)-size) < n {
+		return nil, nil, false
+	}
+	return p[size : size+int(n)], p[size+int(n):], true
+}
+
+// AddValue logs and adds value to the set at key. See Err for failures.
+func (d *Durable[T]) AddValue(key Key, value T) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.write(walAddValue, key, &value) {
+		d.m.AddValue(key, value)
+	}
+}
+
+// RemoveValue logs and removes value from the set at key. See Err for
+// failures.
+func (d *Durable[T]) RemoveValue(key Key, value T) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.write(walRemoveValue, key, &value) {
+		d.m.RemoveValue(key, value)
+	}
+}
+
+// RemoveKey logs and removes key and its values. See Err for failures.
+func (d *Durable[T]) RemoveKey(key Key) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.write(walRemoveKey, key, nil) {
+		d.m.RemoveKey(key)
+	}
+}
+
+// Clear logs and removes all keys and values. See Err for failures.
+func (d *Durable[T]) Clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.write(walClear, nil, nil) {
+		d.m.Clear()
+	}
+}
+
+// PopFirst removes the smallest key, logged like RemoveKey, and returns it
+// with its values. If the log write fails, found is false. See Err for
+// failures.
+func (d *Durable[T]) PopFirst() (first Key, values *set3.Set3[T], found bool) {
+	return d.pop(d.m.FirstKey)
+}
+
+// PopLast removes the greatest key, logged like RemoveKey, and returns it
+// with its values. It behaves like PopFirst otherwise.
+func (d *Durable[T]) PopLast() (last Key, values *set3.Set3[T], found bool) {
+	return d.pop(d.m.LastKey)
+}
+
+// PopFirstMatching removes the smallest key accepted by accept like
+// PopFirst. Rejected keys are left in place, see TypedMultiMap.PopFirst.
+func (d *Durable[T]) PopFirstMatching(accept func(Key) bool) (first Key, values *set3.Set3[T], found bool) {
+	return d.pop(func() (Key, bool) {
+		k, found := d.m.FirstKey()
+		for found && !accept(k) {
+			k, _, found = d.m.Higher(k)
+		}
+		return k, found
+	})
+}
+
+// PopLastMatching removes the greatest key accepted by accept like PopLast.
+// Rejected keys are left in place.
+func (d *Durable[T]) PopLastMatching(accept func(Key) bool) (last Key, values *set3.Set3[T], found bool) {
+	return d.pop(func() (Key, bool) {
+		k, found := d.m.LastKey()
+		for found && !accept(k) {
+			k, _, found = d.m.Lower(k)
+		}
+		return k, found
+	})
+}
+
+// pop removes the key returned by find. Holding the lock between finding and
+// removing the key keeps the pop atomic, since all mutations take the lock.
+func (d *Durable[T]) pop(find func() (Key, bool)) (Key, *set3.Set3[T], bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key, found := find()
+	if !found || !d.write(walRemoveKey, key, nil) {
+		return nil, set3.EmptyWithCapacity[T](0), false
+	}
+	values := d.m.ValuesFor(key)
+	d.m.RemoveKey(key)
+	return key, values, true
+}
+
+// write appends a record to the log and syncs it according to the policy. It
+// reports whether the record was written, in which case the mutation must be
+// applied even if syncing failed, since it will be replayed. The caller must
+// hold the lock.
+func (d *Durable[T]) write(op byte, key Key, value *T) bool {
+	if d.err != nil {
+		return false
+	}
+	record := make([]byte, walHeaderSize, walHeaderSize+1+len(key)+16)
+	record = append(record, op)
+	if op != walClear {
+		record = binary.AppendUvarint(record, uint64(len(key)))
+		record = append(record, key...)
+	}
+	if value != nil {
+		p, err := d.codec.EncodeValue(*value)
+		if err != nil {
+			d.err = err
+			return false
+		}
+		record = binary.AppendUvarint(record, uint64(len(p)))
+		record = append(record, p...)
+	}
+	payload := record[walHeaderSize:]
+	binary.BigEndian.PutUint32(record, uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:], crc32.Checksum(payload, castagnoli))
+	binary.BigEndian.PutUint32(record[8:], crc32.Checksum(record[:8], castagnoli))
+	if _, err := d.log.Write(record); err != nil {
+		// a partially written record is discarded by the next OpenDurable
+		d.err = err
+		return false
+	}
+	d.dirty = true
+	if d.opts.Sync == SyncAlways {
+		d.err = d.syncLocked()
+	}
+	return true
+}
+
+// Err returns the first error a mutation failed with, or ErrClosed after
+// Close. Once Err returns an error, all further mutations are rejected; the
+// in-memory map holds exactly the mutations that were written to the log.
+func (d *Durable[T]) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// Sync flushes the log to stable storage.
+func (d *Durable[T]) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	return d.syncLocked()
+}
+
+func (d *Durable[T]) syncLocked() error {
+	d.dirty = false
+	return d.log.Sync()
+}
+
+// Snapshot writes the whole map to a new snapshot file and truncates the
+// log, so the next OpenDurable replays only mutations made after it.
+// Mutations are blocked while the snapshot is written. The snapshot is
+// written to a temporary file and renamed, so a crash leaves either the old
+// or the new snapshot in place.
+func (d *Durable[T]) Snapshot() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	path := filepath.Join(d.dir, durableSnapshotFile)
+	if err := d.writeSnapshot(path + durableTempSuffix); err != nil {
+		return err
+	}
+	if err := os.Rename(path+durableTempSuffix, path); err != nil {
+		return err
+	}
+	syncDir(d.dir)
+	if err := d.log.Truncate(0); err != nil {
+		// the snapshot is complete, but the log can no longer be appended to
+		// consistently
+		d.err = err
+		return err
+	}
+	return d.syncLocked()
+}
+
+// writeSnapshot writes the map to path and syncs the file.
+func (d *Durable[T]) writeSnapshot(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = WriteBinary(f, d.m, d.codec)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// syncDir makes a rename in dir durable. Errors are ignored, since not every
+// platform supports syncing directories.
+func syncDir(dir string) {
+	if f, err := os.Open(dir); err == nil {
+		f.Sync()
+		f.Close()
+	}
+}
+
+// Close syncs and closes the log. The in-memory map remains readable, but
+// further mutations are rejected with ErrClosed.
+func (d *Durable[T]) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if errors.Is(d.err, ErrClosed) {
+		return nil
+	}
+	if d.stop != nil {
+		close(d.stop)
+	}
+	err := d.log.Sync()
+	if closeErr := d.log.Close(); err == nil {
+		err = closeErr
+	}
+	d.err = ErrClosed
+	return err
+}
+
+// ViewAll calls f with an iterator over all keys and their values in
+// ascending order while no mutation can take place, see WriteBinary. The
+// yielded keys and sets must not be modified or retained, and f must not
+// write to d.
+func (d *Durable[T]) ViewAll(f func(all iter.Seq2[Key, *set3.Set3[T]]) error) error {
+	if v, ok := d.m.(allViewer[T]); ok {
+		return v.ViewAll(f)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return f(d.m.All())
+}
+
+// ContainsKey reads the in-memory map, see MultiMap.ContainsKey.
+func (d *Durable[T]) ContainsKey(key Key) bool { return d.m.ContainsKey(key) }
+
+// ValuesFor reads the in-memory map, see MultiMap.ValuesFor.
+func (d *Durable[T]) ValuesFor(key Key) *set3.Set3[T] { return d.m.ValuesFor(key) }
+
+// ValuesBetweenInclusive reads the in-memory map, see MultiMap.ValuesBetweenInclusive.
+func (d *Durable[T]) ValuesBetweenInclusive(from, to Key) *set3.Set3[T] {
+	return d.m.ValuesBetweenInclusive(from, to)
+}
+
+// ValuesBetweenExclusive reads the in-memory map, see MultiMap.ValuesBetweenExclusive.
+func (d *Durable[T]) ValuesBetweenExclusive(from, to Key) *set3.Set3[T] {
+	return d.m.ValuesBetweenExclusive(from, to)
+}
+
+// ValuesFromInclusive reads the in-memory map, see MultiMap.ValuesFromInclusive.
+func (d *Durable[T]) ValuesFromInclusive(from Key) *set3.Set3[T] {
+	return d.m.ValuesFromInclusive(from)
+}
+
+// ValuesFromExclusive reads the in-memory map, see MultiMap.ValuesFromExclusive.
+func (d *Durable[T]) ValuesFromExclusive(from Key) *set3.Set3[T] {
+	return d.m.ValuesFromExclusive(from)
+}
+
+// ValuesToInclusive reads the in-memory map, see MultiMap.ValuesToInclusive.
+func (d *Durable[T]) ValuesToInclusive(to Key) *set3.Set3[T] { return d.m.ValuesToInclusive(to) }
+
+// ValuesToExclusive reads the in-memory map, see MultiMap.ValuesToExclusive.
+func (d *Durable[T]) ValuesToExclusive(to Key) *set3.Set3[T] { return d.m.ValuesToExclusive(to) }
+
+// ValuesWithPrefix reads the in-memory map, see MultiMap.ValuesWithPrefix.
+func (d *Durable[T]) ValuesWithPrefix(prefix Key) *set3.Set3[T] {
+	return d.m.ValuesWithPrefix(prefix)
+}
+
+// AllValues reads the in-memory map, see MultiMap.AllValues.
+func (d *Durable[T]) AllValues() *set3.Set3[T] { return d.m.AllValues() }
+
+// Floor reads the in-memory map, see MultiMap.Floor.
+func (d *Durable[T]) Floor(key Key) (Key, *set3.Set3[T], bool) { return d.m.Floor(key) }
+
+// Ceiling reads the in-memory map, see MultiMap.Ceiling.
+func (d *Durable[T]) Ceiling(key Key) (Key, *set3.Set3[T], bool) { return d.m.Ceiling(key) }
+
+// Lower reads the in-memory map, see MultiMap.Lower.
+func (d *Durable[T]) Lower(key Key) (Key, *set3.Set3[T], bool) { return d.m.Lower(key) }
+
+// Higher reads the in-memory map, see MultiMap.Higher.
+func (d *Durable[T]) Higher(key Key) (Key, *set3.Set3[T], bool) { return d.m.Higher(key) }
+
+// LongestPrefixMatch reads the in-memory map, see MultiMap.LongestPrefixMatch.
+func (d *Durable[T]) LongestPrefixMatch(key Key) (Key, *set3.Set3[T], bool) {
+	return d.m.LongestPrefixMatch(key)
+}
+
+// FirstKey reads the in-memory map, see MultiMap.FirstKey.
+func (d *Durable[T]) FirstKey() (Key, bool) { return d.m.FirstKey() }
+
+// LastKey reads the in-memory map, see MultiMap.LastKey.
+func (d *Durable[T]) LastKey() (Key, bool) { return d.m.LastKey() }
+
+// NumberOfKeys reads the in-memory map, see MultiMap.NumberOfKeys.
+func (d *Durable[T]) NumberOfKeys() uint64 { return d.m.NumberOfKeys() }
+
+// AllKeys reads the in-memory map, see MultiMap.AllKeys.
+func (d *Durable[T]) AllKeys() []Key { return d.m.AllKeys() }
+
+// All reads the in-memory map, see MultiMap.All.
+func (d *Durable[T]) All() iter.Seq2[Key, *set3.Set3[T]] { return d.m.All() }
+
+// Keys reads the in-memory map, see MultiMap.Keys.
+func (d *Durable[T]) Keys() iter.Seq[Key] { return d.m.Keys() }
+
+// KeysWithPrefix reads the in-memory map, see MultiMap.KeysWithPrefix.
+func (d *Durable[T]) KeysWithPrefix(prefix Key) iter.Seq[Key] { return d.m.KeysWithPrefix(prefix) }
+
+// Values reads the in-memory map, see MultiMap.Values.
+func (d *Durable[T]) Values() iter.Seq[T] { return d.m.Values() }
+
+// Range reads the in-memory map, see MultiMap.Range.
+func (d *Durable[T]) Range(from, to Key, inclusive bool) iter.Seq2[Key, *set3.Set3[T]] {
+	return d.m.Range(from, to, inclusive)
+}
+
+// EntriesBetweenInclusive reads the in-memory map, see MultiMap.EntriesBetweenInclusive.
+func (d *Durable[T]) EntriesBetweenInclusive(from, to Key) iter.Seq2[Key, *set3.Set3[T]] {
+	return d.m.EntriesBetweenInclusive(from, to)
+}
+
+// EntriesBetweenExclusive reads the in-memory map, see MultiMap.EntriesBetweenExclusive.
+func (d *Durable[T]) EntriesBetweenExclusive(from, to Key) iter.Seq2[Key, *set3.Set3[T]] {
+	return d.m.EntriesBetweenExclusive(from, to)
+}
+
+// EntriesFromInclusive reads the in-memory map, see MultiMap.EntriesFromInclusive.
+func (d *Durable[T]) EntriesFromInclusive(from Key) iter.Seq2[Key, *set3.Set3[T]] {
+	return d.m.EntriesFromInclusive(from)
+}
+
+// EntriesFromExclusive reads the in-memory map, see MultiMap.EntriesFromExclusive.
+func (d *Durable[T]) EntriesFromExclusive(from Key) iter.Seq2[Key, *set3.Set3[T]] {
+	return d.m.EntriesFromExclusive(from)
+}
+
+// EntriesToInclusive reads the in-memory map, see MultiMap.EntriesToInclusive.
+func (d *Durable[T]) EntriesToInclusive(to Key) iter.Seq2[Key, *set3.Set3[T]] {
+	return d.m.EntriesToInclusive(to)
+}
+
+// EntriesToExclusive reads the in-memory map, see MultiMap.EntriesToExclusive.
+func (d *Durable[T]) EntriesToExclusive(to Key) iter.Seq2[Key, *set3.Set3[T]] {
+	return d.m.EntriesToExclusive(to)
+}
@@ -0,0 +1,211 @@
+package multimap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	set3 "github.com/TomTonic/Set3"
+)
+
+func openDurable(t *testing.T, dir string) *Durable[string] {
+	t.Helper()
+	d, err := OpenDurable[string](dir, New[string](), StringCodec{}, DurableOptions{})
+	if err != nil {
+		t.Fatalf("OpenDurable: %v", err)
+	}
+	return d
+}
+
+func TestDurableReplaysLog(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	d.AddValue(FromString("a"), "1")
+	d.AddValue(FromString("a"), "2")
+	d.AddValue(FromString("b"), "3")
+	d.AddValue(FromString("c"), "4")
+	d.RemoveValue(FromString("a"), "1")
+	d.RemoveKey(FromString("b"))
+	if k, values, found := d.PopLast(); !found || !k.Equal(FromString("c")) || !values.Equals(set3.From("4")) {
+		t.Fatalf("PopLast() = %v, %v, %v", k, values, found)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d = openDurable(t, dir)
+	defer d.Close()
+	if d.NumberOfKeys() != 1 || !d.ValuesFor(FromString("a")).Equals(set3.From("2")) {
+		t.Fatalf("replayed map has keys %v", d.AllKeys())
+	}
+	d.Clear()
+	d.AddValue(FromString("z"), "after clear")
+	d.Close()
+	d = openDurable(t, dir)
+	if !slices.EqualFunc(d.AllKeys(), []Key{FromString("z")}, Key.Equal) {
+		t.Fatalf("Clear was not replayed, keys %v", d.AllKeys())
+	}
+}
+
+func TestDurableSnapshotTruncatesLog(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	for _, s := range []string{"x", "y", "z"} {
+		d.AddValue(FromString(s), s)
+	}
+	logBeforeSnapshot, _ := os.ReadFile(filepath.Join(dir, durableLogFile))
+	if err := d.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, durableLogFile)); info.Size() != 0 {
+		t.Fatalf("log should be empty after Snapshot, has %d bytes", info.Size())
+	}
+	d.RemoveKey(FromString("y"))
+	d.Close()
+
+	d = openDurable(t, dir)
+	if d.NumberOfKeys() != 2 || d.ContainsKey(FromString("y")) {
+		t.Fatalf("expected x and z after snapshot and replay, got %v", d.AllKeys())
+	}
+	d.Close()
+
+	// a crash between writing the snapshot and truncating the log leaves
+	// records that are already part of the snapshot; replaying them is harmless
+	d = openDurable(t, dir)
+	d.Snapshot()
+	d.Close()
+	os.WriteFile(filepath.Join(dir, durableLogFile), logBeforeSnapshot, 0o644)
+	d = openDurable(t, dir)
+	defer d.Close()
+	if d.NumberOfKeys() != 3 {
+		t.Fatalf("replaying an old log on a snapshot should re-add y only, got %v", d.AllKeys())
+	}
+}
+
+func TestDurableDiscardsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	d.AddValue(FromString("kept"), "1")
+	d.AddValue(FromString("torn"), "2")
+	d.Close()
+
+	path := filepath.Join(dir, durableLogFile)
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, data[:len(data)-2], 0o644)
+
+	d = openDurable(t, dir)
+	if d.NumberOfKeys() != 1 || !d.ContainsKey(FromString("kept")) {
+		t.Fatalf("expected only the intact record, got %v", d.AllKeys())
+	}
+	d.AddValue(FromString("new"), "3")
+	d.Close()
+	d = openDurable(t, dir)
+	defer d.Close()
+	if d.NumberOfKeys() != 2 || !d.ContainsKey(FromString("new")) {
+		t.Fatalf("records after a discarded tail should be replayed, got %v", d.AllKeys())
+	}
+}
+
+func TestDurableRejectsDamageBeforeIntactRecords(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	d.AddValue(FromString("a"), "1")
+	d.AddValue(FromString("b"), "2")
+	d.AddValue(FromString("c"), "3")
+	d.Close()
+
+	path := filepath.Join(dir, durableLogFile)
+	data, _ := os.ReadFile(path)
+	damaged := slices.Clone(data)
+	// flip a bit in the value of the second record
+	damaged[len(data)*2/3-2] ^= 1
+	os.WriteFile(path, damaged, 0o644)
+	if _, err := OpenDurable[string](dir, New[string](), StringCodec{}, DurableOptions{}); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("expected ErrChecksum for a damaged record in the middle, got %v", err)
+	}
+	if kept, _ := os.ReadFile(path); !slices.Equal(kept, damaged) {
+		t.Fatalf("OpenDurable must not truncate a log with damage in the middle")
+	}
+
+	// a damaged length must not be mistaken for a record cut short by the
+	// end of the file
+	damaged = slices.Clone(data)
+	damaged[2] ^= 0x10
+	os.WriteFile(path, damaged, 0o644)
+	if _, err := OpenDurable[string](dir, New[string](), StringCodec{}, DurableOptions{}); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("expected ErrChecksum for a damaged record length, got %v", err)
+	}
+	if kept, _ := os.ReadFile(path); !slices.Equal(kept, damaged) {
+		t.Fatalf("OpenDurable must not truncate a log with a damaged record length")
+	}
+
+	// zeros after the last record, as left by a crash while extending the
+	// file, are discarded
+	os.WriteFile(path, append(slices.Clone(data), make([]byte, 100)...), 0o644)
+	d = openDurable(t, dir)
+	defer d.Close()
+	if d.NumberOfKeys() != 3 {
+		t.Fatalf("expected all three records, got %v", d.AllKeys())
+	}
+}
+
+func TestDurableRejectsMutationsAfterClose(t *testing.T) {
+	d := openDurable(t, t.TempDir())
+	d.Close()
+	d.AddValue(FromString("late"), "1")
+	if !errors.Is(d.Err(), ErrClosed) || d.ContainsKey(FromString("late")) {
+		t.Fatalf("mutation after Close should be rejected, Err() = %v", d.Err())
+	}
+	if _, _, found := d.PopFirst(); found {
+		t.Fatalf("PopFirst after Close should find nothing")
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("second Close = %v", err)
+	}
+}
+
+func TestDurableSyncsPeriodicallyWithoutMutations(t *testing.T) {
+	opts := DurableOptions{Sync: SyncPeriodic}
+	if _, err := OpenDurable[string](t.TempDir(), New[string](), StringCodec{}, opts); err == nil {
+		t.Fatalf("SyncPeriodic without a SyncInterval should be rejected")
+	}
+	opts.SyncInterval = 5 * time.Millisecond
+	d, err := OpenDurable[string](t.TempDir(), New[string](), StringCodec{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.AddValue(FromString("last"), "1")
+	// no further mutation follows, the background goroutine has to sync
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		d.mu.Lock()
+		dirty := d.dirty
+		d.mu.Unlock()
+		if !dirty {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the log was not synced in the background")
+		}
+	}
+}
+
+func TestDurableTypedPopSkipsUndecodableKeys(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	d.AddValue(FromString("not an int"), "bad")
+	typed := WrapTyped[int64, string](d, IntCodec[int64]{})
+	typed.AddValue(7, "seven")
+	if k, _, found := typed.PopFirst(); !found || k != 7 {
+		t.Fatalf("PopFirst() = %d, %v", k, found)
+	}
+	d.Close()
+	d = openDurable(t, dir)
+	defer d.Close()
+	if !slices.EqualFunc(d.AllKeys(), []Key{FromString("not an int")}, Key.Equal) {
+		t.Fatalf("the pop should have been logged, keys %v", d.AllKeys())
+	}
+}
@@ -0,0 +1,143 @@
+package multimap
+
+import (
+	"bytes"
+	"encoding/json"
+	"iter"
+	"slices"
+
+	set3 "github.com/TomTonic/Set3"
+)
+
+// JSON format
+// -----------
+// MarshalJSON writes a MultiMap as an array of entries in ascending key
+// order, each with the key as text (see Key.MarshalText) and its values as a
+// JSON array:
+//
+//	[{"key":"0161","values":[1,2]},{"key":"0162","values":[3]}]
+//
+// Values are sorted by their JSON encoding, so equal maps always produce the
+// same output. TypedMultiMap writes its keys as decoded JSON values of type K
+// instead, e.g. {"key":"alice","values":[1]}. Tuple implements
+// encoding.TextMarshaler, so keys of TupleCodec are written as the text of
+// their tuple Key. Keys without values are skipped, since they cannot be
+// restored through AddValue.
+
+// jsonEntry is one element of the JSON array of a MultiMap.
+type jsonEntry[K, T any] struct {
+	Key    K   `json:"key"`
+	Values []T `json:"values"`
+}
+
+// MarshalJSON returns the JSON encoding of m described above. Both MultiMap
+// implementations of this module implement json.Marshaler with it and are
+// read-locked while they are encoded, like in WriteBinary.
+func MarshalJSON[T comparable](m MultiMap[T]) ([]byte, error) {
+	if v, ok := m.(allViewer[T]); ok {
+		var data []byte
+		err := v.ViewAll(func(all iter.Seq2[Key, *set3.Set3[T]]) error {
+			var err error
+			data, err = marshalEntries(all)
+			return err
+		})
+		return data, err
+	}
+	return marshalEntries(m.All())
+}
+
+// UnmarshalJSON adds the keys and values encoded in data by MarshalJSON to m.
+// Values are decoded with encoding/json, so T must round-trip through it. If
+// data is invalid, m is left unchanged.
+func UnmarshalJSON[T comparable](data []byte, m MultiMap[T]) error {
+	entries, err := unmarshalEntries[Key, T](data)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		for _, v := range e.Values {
+			m.AddValue(e.Key, v)
+		}
+	}
+	return nil
+}
+
+// marshalEntries encodes the entries yielded by seq as a JSON array.
+func marshalEntries[K any, T comparable](seq iter.Seq2[K, *set3.Set3[T]]) ([]byte, error) {
+	entries := []jsonEntry[K, json.RawMessage]{}
+	for key, values := range seq {
+		if values.Size() == 0 {
+			continue
+		}
+		encoded := make([]json.RawMessage, 0, values.Size())
+		for v := range values.ImmutableRange() {
+			p, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			encoded = append(encoded, p)
+		}
+		slices.SortFunc(encoded, func(a, b json.RawMessage) int { return bytes.Compare(a, b) })
+		entries = append(entries, jsonEntry[K, json.RawMessage]{Key: key, Values: encoded})
+	}
+	return json.Marshal(entries)
+}
+
+// unmarshalEntries decodes a JSON array written by marshalEntries.
+func unmarshalEntries[K any, T comparable](data []byte) ([]jsonEntry[K, T], error) {
+	var entries []jsonEntry[K, T]
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// MarshalJSON implements json.Marshaler. Keys are written as JSON values of
+// type K decoded by the codec, see the package-level MarshalJSON. Like there,
+// the underlying MultiMap is read-locked while it is encoded if it supports
+// it.
+func (t *TypedMultiMap[K, V]) MarshalJSON() ([]byte, error) {
+	if v, ok := t.m.(allViewer[V]); ok {
+		var data []byte
+		err := v.ViewAll(func(all iter.Seq2[Key, *set3.Set3[V]]) error {
+			var err error
+			data, err = marshalEntries(t.entries(all))
+			return err
+		})
+		return data, err
+	}
+	return marshalEntries(t.All())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It replaces the contents of the
+// underlying MultiMap, so t must have been created by NewTyped or WrapTyped.
+// K and V must round-trip through encoding/json. If data is invalid, t is
+// left unchanged. The new contents are decoded completely first; if the
+// underlying MultiMap implements json.Unmarshaler, as both implementations of
+// this module do, they replace the old ones in one step. Otherwise the map is
+// cleared and refilled, which is not atomic with respect to concurrent
+// readers.
+func (t *TypedMultiMap[K, V]) UnmarshalJSON(data []byte) error {
+	entries, err := unmarshalEntries[K, V](data)
+	if err != nil {
+		return err
+	}
+	if u, ok := t.m.(json.Unmarshaler); ok {
+		encoded := make([]jsonEntry[Key, V], len(entries))
+		for i, e := range entries {
+			encoded[i] = jsonEntry[Key, V]{Key: t.codec.Encode(e.Key), Values: e.Values}
+		}
+		p, err := json.Marshal(encoded)
+		if err != nil {
+			return err
+		}
+		return u.UnmarshalJSON(p)
+	}
+	t.m.Clear()
+	for _, e := range entries {
+		for _, v := range e.Values {
+			t.AddValue(e.Key, v)
+		}
+	}
+	return nil
+}
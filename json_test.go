@@ -0,0 +1,126 @@
+package multimap
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	set3 "github.com/TomTonic/Set3"
+)
+
+func TestKeyTextRoundTrip(t *testing.T) {
+	for _, k := range []Key{{}, {0x01, 0xAB, 0x00}, FromString("héllo"), FromInt64(-1)} {
+		text, err := k.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Key
+		if err := got.UnmarshalText(text); err != nil || !got.Equal(k) {
+			t.Fatalf("UnmarshalText(%q) = %v, %v; want %v", text, got, err, k)
+		}
+	}
+	if text, _ := (Key{0x01, 0xAB}).MarshalText(); string(text) != "01ab" {
+		t.Fatalf("MarshalText() = %q, want 01ab", text)
+	}
+	var k Key
+	for _, bad := range []string{"abc", "zz", "01,ab"} {
+		if err := k.UnmarshalText([]byte(bad)); !errors.Is(err, ErrInvalidKeyText) {
+			t.Fatalf("UnmarshalText(%q) should fail with ErrInvalidKeyText, got %v", bad, err)
+		}
+	}
+
+	// Keys work as JSON object keys via TextMarshaler
+	data, err := json.Marshal(map[string]Key{"k": {0xFF}})
+	if err != nil || string(data) != `{"k":"ff"}` {
+		t.Fatalf("json.Marshal = %s, %v", data, err)
+	}
+}
+
+func TestMultiMapJSONRoundTrip(t *testing.T) {
+	m := New[int]()
+	m.AddValue(FromString("b"), 3)
+	m.AddValue(FromString("a"), 2)
+	m.AddValue(FromString("a"), 1)
+	m.AddValue(FromString("a"), 10)
+
+	data, err := json.Marshal(m)
+	want := `[{"key":"61","values":[1,10,2]},{"key":"62","values":[3]}]`
+	if err != nil || string(data) != want {
+		t.Fatalf("json.Marshal = %s, %v; want %s", data, err, want)
+	}
+
+	loaded := New[int]()
+	loaded.AddValue(FromString("replaced"), 0)
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.NumberOfKeys() != 2 || !loaded.ValuesFor(FromString("a")).Equals(set3.From(1, 2, 10)) {
+		t.Fatalf("unexpected contents after UnmarshalJSON: %v", loaded.AllKeys())
+	}
+	if err := json.Unmarshal([]byte(`[{"key":"xyz","values":[1]}]`), loaded); err == nil || loaded.NumberOfKeys() != 2 {
+		t.Fatalf("invalid key text should fail and keep the map, got %v", err)
+	}
+}
+
+func TestTypedMultiMapJSON(t *testing.T) {
+	m := NewTyped[string, int](StringCodec{})
+	m.AddValue("bob", 2)
+	m.AddValue("alice", 1)
+
+	data, err := json.Marshal(m)
+	want := `[{"key":"alice","values":[1]},{"key":"bob","values":[2]}]`
+	if err != nil || string(data) != want {
+		t.Fatalf("json.Marshal = %s, %v; want %s", data, err, want)
+	}
+	loaded := NewTyped[string, int](StringCodec{})
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.ValuesFor("bob").Equals(set3.From(2)) || loaded.NumberOfKeys() != 2 {
+		t.Fatalf("unexpected contents after UnmarshalJSON: %v", loaded.AllKeys())
+	}
+}
+
+func TestTypedMultiMapJSONTupleKeys(t *testing.T) {
+	m := NewTyped[Tuple, int](TupleCodec{})
+	keys := []Tuple{
+		{"tenant", int64(1), 2.5},
+		{[]byte{0, 1}, Desc(FromInt64(-3))},
+		{"tenant", int64(1) << 60},
+	}
+	for i, k := range keys {
+		m.AddValue(k, i)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewTyped[Tuple, int](TupleCodec{})
+	loaded.AddValue(Tuple{"stale"}, 9)
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(loaded.Unwrap().AllKeys(), m.Unwrap().AllKeys(), Key.Equal) {
+		t.Fatalf("tuple keys changed in a JSON round trip: %s", data)
+	}
+	for i, k := range keys {
+		if !loaded.ValuesFor(k).Equals(set3.From(i)) {
+			t.Fatalf("ValuesFor(%v) = %v after a JSON round trip", k, loaded.ValuesFor(k))
+		}
+	}
+	if _, err := json.Marshal(Tuple{struct{}{}}); !errors.Is(err, ErrInvalidTuple) {
+		t.Fatalf("expected ErrInvalidTuple for an unsupported element, got %v", err)
+	}
+}
+
+func TestTypedMultiMapUnmarshalJSONKeepsContentsOnError(t *testing.T) {
+	m := NewTyped[string, int](StringCodec{})
+	m.AddValue("alice", 1)
+	if err := json.Unmarshal([]byte(`[{"key":"bob","values":[2]},{"key":1}]`), m); err == nil {
+		t.Fatalf("expected an error for a numeric string key")
+	}
+	if !m.ValuesFor("alice").Equals(set3.From(1)) || m.NumberOfKeys() != 1 {
+		t.Fatalf("a failed UnmarshalJSON should leave the map unchanged: %v", m.AllKeys())
+	}
+}
@@ -2,7 +2,12 @@ package multimap
 
 import (
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"golang.org/x/text/unicode/norm"
 )
@@ -151,6 +156,116 @@ func FromUint8(u uint8) Key {
 // FromByte is an alias for FromUint8 and produces an 8-byte representation.
 func FromByte(b byte) Key { return FromUint8(uint8(b)) }
 
+// FromFloat64 converts a float64 to an 8-byte big-endian Key whose byte-wise
+// order matches numeric order, from -Inf over negative values, zero and
+// positive values to +Inf. It uses the sign-flip transform of the IEEE 754
+// bits: for negative values all bits are inverted, for positive values only
+// the sign bit is set.
+//
+// -0 is encoded like +0, so both yield the same Key. All NaN values are
+// encoded as one canonical NaN that compares greater than +Inf.
+//
+// Float keys have the same width as integer keys and, like them, order negative
+// values before zero (FromFloat64(0) equals FromInt64(0)) and positive values.
+// A float key and an integer key for the same non-zero number differ, however,
+// so the two encodings should not be mixed within one range.
+func FromFloat64(f float64) Key {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], float64Bits(f))
+	return FromBytes(b[:])
+}
+
+// FromFloat32 converts a float32 to an 8-byte big-endian Key. The value is
+// widened to float64 first, so FromFloat32(x) equals FromFloat64(float64(x))
+// and float32 and float64 keys are comparable. See FromFloat64 for the
+// encoding and the handling of -0 and NaN.
+func FromFloat32(f float32) Key {
+	return FromFloat64(float64(f))
+}
+
+// float64Bits returns the order-preserving sign-flip transform of f.
+func float64Bits(f float64) uint64 {
+	switch {
+	case math.IsNaN(f):
+		f = math.NaN()
+	case f == 0:
+		f = 0 // turns -0 into +0
+	}
+	u := math.Float64bits(f)
+	if u&(1<<63) != 0 {
+		return ^u
+	}
+	return u | 1<<63
+}
+
+// FromTime converts t to an 8-byte Key whose byte-wise order matches
+// chronological order. The key holds the nanoseconds since the Unix epoch,
+// encoded like FromInt64, so it does not depend on the location of t: the
+// same instant in different time zones yields the same Key. Times before the
+// year 1678 or after the year 2262 do not fit into int64 nanoseconds and are
+// clamped to the smallest and greatest representable instant. Use Key.Time
+// to decode the Key.
+func FromTime(t time.Time) Key {
+	return FromInt64(unixNano(t))
+}
+
+// FromTimeTruncated is like FromTime but rounds t down to a multiple of
+// precision since the Unix epoch, for example time.Second or time.Hour, so
+// all instants within one bucket yield the same Key. The result stays in
+// nanoseconds and is comparable with keys of any other precision. A precision
+// less than or equal to zero returns FromTime(t).
+func FromTimeTruncated(t time.Time, precision time.Duration) Key {
+	return FromInt64(floorToMultiple(unixNano(t), int64(precision)))
+}
+
+// FromDuration converts d to an 8-byte Key holding its nanoseconds, encoded
+// like FromInt64, so negative durations sort before positive ones. Use
+// Key.Duration to decode the Key.
+func FromDuration(d time.Duration) Key {
+	return FromInt64(int64(d))
+}
+
+// FromDurationTruncated is like FromDuration but rounds d down to a multiple
+// of precision. Unlike time.Duration.Truncate it rounds towards negative
+// infinity, so buckets of negative durations have the same size as those of
+// positive ones. A precision less than or equal to zero returns
+// FromDuration(d).
+func FromDurationTruncated(d, precision time.Duration) Key {
+	return FromInt64(floorToMultiple(int64(d), int64(precision)))
+}
+
+var (
+	minUnixNano = time.Unix(0, math.MinInt64)
+	maxUnixNano = time.Unix(0, math.MaxInt64)
+)
+
+// unixNano returns t.UnixNano(), clamped to the range of int64 nanoseconds.
+func unixNano(t time.Time) int64 {
+	switch {
+	case t.Before(minUnixNano):
+		return math.MinInt64
+	case t.After(maxUnixNano):
+		return math.MaxInt64
+	}
+	return t.UnixNano()
+}
+
+// floorToMultiple rounds v down to a multiple of m. It returns v if m <= 0
+// and the smallest multiple of m if rounding down would overflow.
+func floorToMultiple(v, m int64) int64 {
+	if m <= 0 {
+		return v
+	}
+	r := v % m
+	if r < 0 {
+		if v-r < math.MinInt64+m {
+			return v - r
+		}
+		r += m
+	}
+	return v - r
+}
+
 // FromRune converts a rune to its UTF-8 encoding as a Key.
 func FromRune(r rune) Key {
 	// encode rune to UTF-8 bytes
@@ -159,6 +274,86 @@ func FromRune(r rune) Key {
 	return FromBytes(buf[:n])
 }
 
+// ErrKeyLength is returned when a Key is decoded into a type whose
+// encoding has a different length.
+var ErrKeyLength = errors.New("multimap: key length does not match the requested type")
+
+// ErrInvalidUTF8 is returned when a Key that is not valid UTF-8 is decoded
+// into a string.
+var ErrInvalidUTF8 = errors.New("multimap: key is not valid UTF-8")
+
+// Int64 decodes a Key produced by FromInt64 or any other signed integer
+// constructor by removing the 1<<63 offset. It returns ErrKeyLength if k is
+// not 8 bytes long.
+func (k Key) Int64() (int64, error) {
+	u, err := k.uint64Bits()
+	if err != nil {
+		return 0, err
+	}
+	return int64(u - 1<<63), nil
+}
+
+// Uint64 decodes a Key produced by FromUint64 or any other unsigned integer
+// constructor by removing the 1<<63 offset. It returns ErrKeyLength if k is
+// not 8 bytes long.
+func (k Key) Uint64() (uint64, error) {
+	u, err := k.uint64Bits()
+	if err != nil {
+		return 0, err
+	}
+	return u - 1<<63, nil
+}
+
+// Float64 decodes a Key produced by FromFloat64 or FromFloat32 by undoing the
+// sign-flip transform. Keys of -0 decode to +0 and all NaN keys decode to NaN.
+// It returns ErrKeyLength if k is not 8 bytes long.
+func (k Key) Float64() (float64, error) {
+	u, err := k.uint64Bits()
+	if err != nil {
+		return 0, err
+	}
+	if u&(1<<63) != 0 {
+		return math.Float64frombits(u &^ (1 << 63)), nil
+	}
+	return math.Float64frombits(^u), nil
+}
+
+// StringValue decodes a Key produced by FromString or FromRune. It is named
+// StringValue because String formats the Key for debugging. It returns
+// ErrInvalidUTF8 if k is not valid UTF-8, for example because it was produced
+// by a numeric constructor.
+func (k Key) StringValue() (string, error) {
+	if !utf8.Valid(k) {
+		return "", ErrInvalidUTF8
+	}
+	return string(k), nil
+}
+
+// Time decodes a Key produced by FromTime or FromTimeTruncated. The result is
+// in UTC. It returns ErrKeyLength if k is not 8 bytes long.
+func (k Key) Time() (time.Time, error) {
+	ns, err := k.Int64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ns).UTC(), nil
+}
+
+// Duration decodes a Key produced by FromDuration or FromDurationTruncated.
+// It returns ErrKeyLength if k is not 8 bytes long.
+func (k Key) Duration() (time.Duration, error) {
+	ns, err := k.Int64()
+	return time.Duration(ns), err
+}
+
+// uint64Bits returns the 8 big-endian bytes of k as an uint64.
+func (k Key) uint64Bits() (uint64, error) {
+	if len(k) != 8 {
+		return 0, ErrKeyLength
+	}
+	return binary.BigEndian.Uint64(k), nil
+}
+
 // Bytes returns a copy of the Key as a byte slice.
 func (k Key) Bytes() []byte {
 	if k == nil {
@@ -180,7 +375,8 @@ func (k Key) Clone() Key {
 }
 
 // String returns the Key as a string consisting of uppercase hex tuples per byte,
-// separated by commas and surrounded by `[]` (e.g. `[01,AB,00]`).
+// separated by commas and surrounded by `[]` (e.g. `[01,AB,00]`). Use
+// TypedString for keys produced by the TypedFrom constructors.
 func (k Key) String() string {
 	if len(k) == 0 {
 		return "[]"
@@ -199,6 +395,29 @@ func (k Key) String() string {
 	return sb.String()
 }
 
+// ErrInvalidKeyText is returned by Key.UnmarshalText for text that is not an
+// even number of hexadecimal digits.
+var ErrInvalidKeyText = errors.New("multimap: key text is not hexadecimal")
+
+// MarshalText implements encoding.TextMarshaler. It returns the bytes of k as
+// lowercase hex digits without separators, e.g. `01ab00`, so Keys can be used
+// in JSON documents and as JSON object keys. The empty Key yields empty text.
+func (k Key) MarshalText() ([]byte, error) {
+	return hex.AppendEncode(nil, k), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler and decodes the output of
+// MarshalText. Upper case hex digits are accepted as well. It returns
+// ErrInvalidKeyText for any other text.
+func (k *Key) UnmarshalText(text []byte) error {
+	b, err := hex.AppendDecode(make([]byte, 0, len(text)/2), text)
+	if err != nil {
+		return ErrInvalidKeyText
+	}
+	*k = b
+	return nil
+}
+
 // Equal reports whether k and other have the same contents.
 func (k Key) Equal(other Key) bool {
 	if len(k) != len(other) {
@@ -236,6 +455,32 @@ func (k Key) LessThanOrEqual(other Key) bool {
 	return len(k) <= len(other)
 }
 
+// Compare returns -1 if k is lexicographically less than other, +1 if it is
+// greater and 0 if both are equal. It is consistent with LessThan and Equal and
+// can be used with the sort and slices packages.
+func (k Key) Compare(other Key) int {
+	for i := 0; i < min(len(k), len(other)); i++ {
+		if k[i] < other[i] {
+			return -1
+		} else if k[i] > other[i] {
+			return 1
+		}
+	}
+	switch {
+	case len(k) < len(other):
+		return -1
+	case len(k) > len(other):
+		return 1
+	}
+	return 0
+}
+
+// HasPrefix reports whether k begins with the bytes of prefix. Every key has
+// the empty prefix.
+func (k Key) HasPrefix(prefix Key) bool {
+	return len(k) >= len(prefix) && k[:len(prefix)].Equal(prefix)
+}
+
 // IsEmpty returns whether the Key is empty or nil.
 func (k Key) IsEmpty() bool { return len(k) == 0 }
 
@@ -3,7 +3,10 @@ package multimap
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"math"
 	"testing"
+	"time"
 )
 
 func TestFromBytesCopies(t *testing.T) {
@@ -452,3 +455,190 @@ func TestLessThanOrEqual_ConsistencyWithLessThanAndEqual(t *testing.T) {
 		}
 	}
 }
+
+func TestCompare_ConsistencyWithLessThanAndEqual(t *testing.T) {
+	cases := []struct {
+		a, b Key
+		want int
+	}{
+		{FromBytes([]byte{1, 2, 3}), FromBytes([]byte{1, 2, 3}), 0},
+		{FromBytes([]byte{1, 2, 3}), FromBytes([]byte{1, 2, 4}), -1},
+		{FromBytes([]byte{1, 2, 4}), FromBytes([]byte{1, 2, 3}), 1},
+		{FromBytes([]byte{1, 2}), FromBytes([]byte{1, 2, 0}), -1},
+		{FromBytes([]byte{1, 2, 0}), FromBytes([]byte{1, 2}), 1},
+		{nil, FromBytes([]byte{}), 0},
+		{nil, FromBytes([]byte{0}), -1},
+	}
+
+	for _, c := range cases {
+		if got := c.a.Compare(c.b); got != c.want {
+			t.Fatalf("Compare(%v, %v) = %d, want %d", c.a.Bytes(), c.b.Bytes(), got, c.want)
+		}
+		if (c.want < 0) != c.a.LessThan(c.b) || (c.want == 0) != c.a.Equal(c.b) {
+			t.Fatalf("Compare(%v, %v) inconsistent with LessThan/Equal", c.a.Bytes(), c.b.Bytes())
+		}
+	}
+}
+
+func TestHasPrefix(t *testing.T) {
+	k := FromBytes([]byte{1, 2, 3})
+	for _, p := range []Key{nil, {}, {1}, {1, 2, 3}} {
+		if !k.HasPrefix(p) {
+			t.Fatalf("expected %v to have prefix %v", k.Bytes(), p.Bytes())
+		}
+	}
+	for _, p := range []Key{{2}, {1, 3}, {1, 2, 3, 0}} {
+		if k.HasPrefix(p) {
+			t.Fatalf("expected %v not to have prefix %v", k.Bytes(), p.Bytes())
+		}
+	}
+}
+
+func TestFloat64Ordering(t *testing.T) {
+	values := []float64{
+		math.Inf(-1), -math.MaxFloat64, -1e10, -1.5, -math.SmallestNonzeroFloat64,
+		0, math.SmallestNonzeroFloat64, 0.25, 1, 1e10, math.MaxFloat64, math.Inf(1), math.NaN(),
+	}
+	for i := 1; i < len(values); i++ {
+		a, b := FromFloat64(values[i-1]), FromFloat64(values[i])
+		if len(a) != 8 || !a.LessThan(b) {
+			t.Fatalf("expected FromFloat64(%v) < FromFloat64(%v), got %v and %v", values[i-1], values[i], a, b)
+		}
+	}
+}
+
+func TestFloatSpecialValues(t *testing.T) {
+	if !FromFloat64(math.Copysign(0, -1)).Equal(FromFloat64(0)) {
+		t.Fatalf("-0 and +0 should yield the same key")
+	}
+	if !FromFloat64(0).Equal(FromInt64(0)) {
+		t.Fatalf("FromFloat64(0) should equal FromInt64(0)")
+	}
+	negNaN := math.Float64frombits(math.Float64bits(math.NaN()) | 1<<63)
+	if !FromFloat64(negNaN).Equal(FromFloat64(math.NaN())) || !FromFloat32(float32(math.NaN())).Equal(FromFloat64(math.NaN())) {
+		t.Fatalf("all NaNs should yield the canonical NaN key")
+	}
+	for _, f := range []float32{-3.5, 0, 1.25, float32(math.Inf(1))} {
+		if !FromFloat32(f).Equal(FromFloat64(float64(f))) {
+			t.Fatalf("FromFloat32(%v) should equal FromFloat64 of the widened value", f)
+		}
+	}
+	if !FromInt64(-1).LessThan(FromFloat64(0.5)) || !FromFloat64(-0.5).LessThan(FromInt64(0)) {
+		t.Fatalf("negative float and integer keys should sort before zero and positive ones")
+	}
+}
+
+func TestTimeKeysFollowChronologicalOrder(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	times := []time.Time{
+		time.Date(1600, 1, 1, 0, 0, 0, 0, time.UTC), // clamped
+		time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC),
+		base.Add(-time.Nanosecond),
+		base,
+		base.Add(time.Millisecond),
+		time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), // clamped
+	}
+	for i := 1; i < len(times); i++ {
+		if !FromTime(times[i-1]).LessThan(FromTime(times[i])) {
+			t.Fatalf("expected FromTime(%v) < FromTime(%v)", times[i-1], times[i])
+		}
+	}
+	berlin := time.FixedZone("CET", 3600)
+	if !FromTime(base).Equal(FromTime(base.In(berlin))) {
+		t.Fatalf("the same instant in different zones should yield the same key")
+	}
+	got, err := FromTime(base.In(berlin)).Time()
+	if err != nil || !got.Equal(base) || got.Location() != time.UTC {
+		t.Fatalf("Time() = %v, %v; want %v in UTC", got, err, base)
+	}
+}
+
+func TestTimeAndDurationTruncation(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if !FromTimeTruncated(base.Add(59*time.Second), time.Minute).Equal(FromTime(base)) {
+		t.Fatalf("times within one minute should share a bucket")
+	}
+	if FromTimeTruncated(base.Add(time.Minute), time.Minute).Equal(FromTime(base)) {
+		t.Fatalf("times in different minutes should not share a bucket")
+	}
+	beforeEpoch := time.Unix(-1, 500)
+	if got, _ := FromTimeTruncated(beforeEpoch, time.Second).Time(); !got.Equal(time.Unix(-1, 0)) {
+		t.Fatalf("truncation before the epoch should round down, got %v", got)
+	}
+	if !FromTimeTruncated(base.Add(7), 0).Equal(FromTime(base.Add(7))) {
+		t.Fatalf("a non-positive precision should not truncate")
+	}
+
+	if !FromDuration(-time.Second).LessThan(FromDuration(0)) || !FromDuration(0).LessThan(FromDuration(time.Nanosecond)) {
+		t.Fatalf("duration keys should follow numeric order")
+	}
+	if d, err := FromDurationTruncated(-1500*time.Millisecond, time.Second).Duration(); err != nil || d != -2*time.Second {
+		t.Fatalf("FromDurationTruncated(-1.5s, 1s) decodes to %v, %v; want -2s", d, err)
+	}
+	nearMin := time.Duration(math.MinInt64 + 1)
+	if d, _ := FromDurationTruncated(nearMin, time.Hour).Duration(); d%time.Hour != 0 || d < nearMin || d-nearMin >= time.Hour {
+		t.Fatalf("truncation near the minimum should not overflow, got %v", d)
+	}
+}
+
+func TestTimeDecodingRejectsWrongLength(t *testing.T) {
+	if _, err := FromString("2024").Time(); !errors.Is(err, ErrKeyLength) {
+		t.Fatalf("expected ErrKeyLength, got %v", err)
+	}
+	if _, err := Key(nil).Duration(); !errors.Is(err, ErrKeyLength) {
+		t.Fatalf("expected ErrKeyLength, got %v", err)
+	}
+}
+
+func TestIntegerDecodingRoundTrips(t *testing.T) {
+	for _, i := range []int64{math.MinInt64, -1, 0, 1, 42, math.MaxInt64} {
+		if got, err := FromInt64(i).Int64(); err != nil || got != i {
+			t.Fatalf("FromInt64(%d).Int64() = %d, %v", i, got, err)
+		}
+	}
+	if got, err := FromInt8(-7).Int64(); err != nil || got != -7 {
+		t.Fatalf("FromInt8(-7).Int64() = %d, %v", got, err)
+	}
+	for _, u := range []uint64{0, 1, 1 << 40, math.MaxUint64} {
+		if got, err := FromUint64(u).Uint64(); err != nil || got != u {
+			t.Fatalf("FromUint64(%d).Uint64() = %d, %v", u, got, err)
+		}
+	}
+	if got, err := FromUint16(65535).Uint64(); err != nil || got != 65535 {
+		t.Fatalf("FromUint16(65535).Uint64() = %d, %v", got, err)
+	}
+}
+
+func TestFloatAndStringDecoding(t *testing.T) {
+	for _, f := range []float64{math.Inf(-1), -2.5, 0, math.SmallestNonzeroFloat64, 1e300, math.Inf(1)} {
+		if got, err := FromFloat64(f).Float64(); err != nil || got != f {
+			t.Fatalf("FromFloat64(%v).Float64() = %v, %v", f, got, err)
+		}
+	}
+	if got, _ := FromFloat64(math.Copysign(0, -1)).Float64(); got != 0 || math.Signbit(got) {
+		t.Fatalf("-0 should decode to +0, got %v", got)
+	}
+	if got, _ := FromFloat64(math.NaN()).Float64(); !math.IsNaN(got) {
+		t.Fatalf("NaN should decode to NaN, got %v", got)
+	}
+	if got, err := FromString("tenant/ä").StringValue(); err != nil || got != "tenant/ä" {
+		t.Fatalf("StringValue() = %q, %v", got, err)
+	}
+	if _, err := FromInt64(-1).StringValue(); !errors.Is(err, ErrInvalidUTF8) {
+		t.Fatalf("expected ErrInvalidUTF8 for an integer key, got %v", err)
+	}
+}
+
+func TestNumericDecodingRejectsWrongLength(t *testing.T) {
+	for _, k := range []Key{nil, FromString("abc"), FromBytes(make([]byte, 9))} {
+		if v, err := k.Int64(); !errors.Is(err, ErrKeyLength) || v != 0 {
+			t.Fatalf("Int64(%v) = %d, %v; want 0, ErrKeyLength", k, v, err)
+		}
+		if v, err := k.Uint64(); !errors.Is(err, ErrKeyLength) || v != 0 {
+			t.Fatalf("Uint64(%v) = %d, %v; want 0, ErrKeyLength", k, v, err)
+		}
+		if v, err := k.Float64(); !errors.Is(err, ErrKeyLength) || v != 0 {
+			t.Fatalf("Float64(%v) = %v, %v; want 0, ErrKeyLength", k, v, err)
+		}
+	}
+}
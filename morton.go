@@ -0,0 +1,185 @@
+package multimap
+
+import (
+	"encoding/binary"
+
+	set3 "github.com/TomTonic/Set3"
+)
+
+// FromMorton2D returns the Morton code (Z-order curve) of the point (x, y)
+// as an 8-byte big-endian Key. The bits of x and y are interleaved, starting
+// with the most significant bit of y, so points that are close in space tend
+// to be close in key order and every aligned square of 2^n x 2^n points
+// covers one contiguous key range. Use ValuesInBox to query a rectangle.
+//
+// Morton keys are not offset like integer keys and are not comparable with
+// them.
+func FromMorton2D(x, y uint32) Key {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], morton2D(x, y))
+	return FromBytes(b[:])
+}
+
+// FromMorton3D returns the Morton code of the point (x, y, z) as a 12-byte
+// big-endian Key, interleaving the bits of x, y and z starting with the most
+// significant bit of z.
+func FromMorton3D(x, y, z uint32) Key {
+	var hi, lo uint64
+	for i := 31; i >= 0; i-- {
+		// shift in z, y, x bit by bit; 96 bits span two words
+		for _, c := range [3]uint32{z, y, x} {
+			hi = hi<<1 | lo>>63
+			lo = lo<<1 | uint64(c>>i&1)
+		}
+	}
+	var b [12]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(hi))
+	binary.BigEndian.PutUint64(b[4:], lo)
+	return FromBytes(b[:])
+}
+
+// Morton2D decodes a Key produced by FromMorton2D. It returns ErrKeyLength
+// if k is not 8 bytes long.
+func (k Key) Morton2D() (x, y uint32, err error) {
+	code, err := k.uint64Bits()
+	if err != nil {
+		return 0, 0, err
+	}
+	return compact2D(code), compact2D(code >> 1), nil
+}
+
+// Morton3D decodes a Key produced by FromMorton3D. It returns ErrKeyLength
+// if k is not 12 bytes long.
+func (k Key) Morton3D() (x, y, z uint32, err error) {
+	if len(k) != 12 {
+		return 0, 0, 0, ErrKeyLength
+	}
+	hi := uint64(binary.BigEndian.Uint32(k[:4]))
+	lo := binary.BigEndian.Uint64(k[4:])
+	for i := 0; i < 32; i++ {
+		// shift out x, y, z bit by bit, least significant first
+		for _, c := range [3]*uint32{&x, &y, &z} {
+			*c |= uint32(lo&1) << i
+			lo = lo>>1 | hi<<63
+			hi >>= 1
+		}
+	}
+	return x, y, z, nil
+}
+
+// ValuesInBox returns a set with all values of m whose keys are FromMorton2D
+// keys of points in the rectangle from (minX, minY) to (maxX, maxY), both
+// corners included. The rectangle is split into contiguous Morton key ranges,
+// which are queried with ValuesBetweenInclusive. The number of ranges grows
+// with the perimeter of the rectangle, so it is capped at maxMortonRanges:
+// for long or thin rectangles, cells crossing the border are covered whole
+// and the keys in them are decoded and filtered through
+// EntriesBetweenInclusive. Keys that are not 8 bytes long are skipped in that
+// case. If minX > maxX or minY > maxY, the result is an empty set. The result
+// set is never nil.
+func ValuesInBox[T comparable](m MultiMap[T], minX, minY, maxX, maxY uint32) *set3.Set3[T] {
+	result := set3.Empty[T]()
+	if minX > maxX || minY > maxY {
+		return result
+	}
+	ranges, exact := mortonRanges2D(minX, minY, maxX, maxY, maxMortonRanges)
+	for _, r := range ranges {
+		var from, to [8]byte
+		binary.BigEndian.PutUint64(from[:], r.from)
+		binary.BigEndian.PutUint64(to[:], r.to)
+		if exact {
+			result.AddAll(m.ValuesBetweenInclusive(from[:], to[:]))
+			continue
+		}
+		for k, values := range m.EntriesBetweenInclusive(from[:], to[:]) {
+			if x, y, err := k.Morton2D(); err == nil && minX <= x && x <= maxX && minY <= y && y <= maxY {
+				result.AddAll(values)
+			}
+		}
+	}
+	return result
+}
+
+// maxMortonRanges is the number of key ranges ValuesInBox queries at most.
+const maxMortonRanges = 64
+
+// zRange is an inclusive range of Morton codes.
+type zRange struct{ from, to uint64 }
+
+// mortonRanges2D returns at most limit Morton code ranges covering the points
+// of the rectangle, in ascending order. Adjacent ranges are merged. If exact
+// is set, the ranges cover exactly the points of the rectangle and no smaller
+// set of ranges does. Otherwise too many ranges were needed and cells that
+// cross the border of the rectangle are covered whole, starting with the
+// smallest cells, until the ranges fit into limit. limit must be positive.
+func mortonRanges2D(minX, minY, maxX, maxY uint32, limit int) (ranges []zRange, exact bool) {
+	for level := uint(0); ; level++ {
+		// level 32 covers the whole plane with one range
+		if ranges, ok := mortonCover2D(minX, minY, maxX, maxY, level, limit); ok {
+			return ranges, level == 0
+		}
+	}
+}
+
+// mortonCover2D covers the rectangle like mortonRanges2D, taking cells of
+// 2^coarse x 2^coarse points or less whole if they overlap the rectangle. It
+// gives up and returns false as soon as more than limit ranges are needed.
+func mortonCover2D(minX, minY, maxX, maxY uint32, coarse uint, limit int) ([]zRange, bool) {
+	var result []zRange
+	var visit func(x, y uint32, level uint) bool
+	visit = func(x, y uint32, level uint) bool {
+		// the cell covers the 2^level x 2^level points starting at (x, y)
+		size := uint64(1)<<level - 1
+		cellMaxX, cellMaxY := uint64(x)+size, uint64(y)+size
+		if uint64(maxX) < uint64(x) || uint64(maxY) < uint64(y) || cellMaxX < uint64(minX) || cellMaxY < uint64(minY) {
+			return true
+		}
+		if level <= coarse || minX <= x && minY <= y && cellMaxX <= uint64(maxX) && cellMaxY <= uint64(maxY) {
+			from := morton2D(x, y)
+			to := from | (uint64(1)<<(2*level) - 1)
+			if n := len(result); n > 0 && result[n-1].to+1 == from {
+				result[n-1].to = to
+				return true
+			}
+			result = append(result, zRange{from, to})
+			return len(result) <= limit
+		}
+		// children in Z order: x is the less significant dimension
+		half := uint32(1) << (level - 1)
+		return visit(x, y, level-1) &&
+			visit(x+half, y, level-1) &&
+			visit(x, y+half, level-1) &&
+			visit(x+half, y+half, level-1)
+	}
+	if !visit(0, 0, 32) {
+		return nil, false
+	}
+	return result, true
+}
+
+// morton2D interleaves the bits of x (even positions) and y (odd positions).
+func morton2D(x, y uint32) uint64 {
+	return spread2D(x) | spread2D(y)<<1
+}
+
+// spread2D moves bit i of v to bit 2*i.
+func spread2D(v uint32) uint64 {
+	u := uint64(v)
+	u = (u | u<<16) & 0x0000FFFF0000FFFF
+	u = (u | u<<8) & 0x00FF00FF00FF00FF
+	u = (u | u<<4) & 0x0F0F0F0F0F0F0F0F
+	u = (u | u<<2) & 0x3333333333333333
+	u = (u | u<<1) & 0x5555555555555555
+	return u
+}
+
+// compact2D is the inverse of spread2D, it collects the even bits of u.
+func compact2D(u uint64) uint32 {
+	u &= 0x5555555555555555
+	u = (u | u>>1) & 0x3333333333333333
+	u = (u | u>>2) & 0x0F0F0F0F0F0F0F0F
+	u = (u | u>>4) & 0x00FF00FF00FF00FF
+	u = (u | u>>8) & 0x0000FFFF0000FFFF
+	u = (u | u>>16) & 0x00000000FFFFFFFF
+	return uint32(u)
+}
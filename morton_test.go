@@ -0,0 +1,159 @@
+package multimap
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+
+	set3 "github.com/TomTonic/Set3"
+)
+
+func TestMortonRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	for i := 0; i < 1000; i++ {
+		x, y, z := rng.Uint32(), rng.Uint32(), rng.Uint32()
+		if gx, gy, err := FromMorton2D(x, y).Morton2D(); err != nil || gx != x || gy != y {
+			t.Fatalf("Morton2D round trip of (%d,%d) = (%d,%d), %v", x, y, gx, gy, err)
+		}
+		k := FromMorton3D(x, y, z)
+		if gx, gy, gz, err := k.Morton3D(); len(k) != 12 || err != nil || gx != x || gy != y || gz != z {
+			t.Fatalf("Morton3D round trip of (%d,%d,%d) = (%d,%d,%d), %v", x, y, z, gx, gy, gz, err)
+		}
+	}
+	if _, _, err := FromMorton3D(1, 2, 3).Morton2D(); !errors.Is(err, ErrKeyLength) {
+		t.Fatalf("expected ErrKeyLength, got %v", err)
+	}
+	if _, _, _, err := FromMorton2D(1, 2).Morton3D(); !errors.Is(err, ErrKeyLength) {
+		t.Fatalf("expected ErrKeyLength, got %v", err)
+	}
+}
+
+func TestMortonInterleaving(t *testing.T) {
+	if !FromMorton2D(1, 0).Equal(Key{0, 0, 0, 0, 0, 0, 0, 0x01}) || !FromMorton2D(0, 1).Equal(Key{0, 0, 0, 0, 0, 0, 0, 0x02}) {
+		t.Fatalf("x should take the even bits and y the odd bits")
+	}
+	if c, _ := FromMorton2D(math.MaxUint32, math.MaxUint32).uint64Bits(); c != math.MaxUint64 {
+		t.Fatalf("the greatest point should yield all one bits, got %X", c)
+	}
+	if !FromMorton3D(1, 0, 0).LessThan(FromMorton3D(0, 1, 0)) || !FromMorton3D(0, 1, 0).LessThan(FromMorton3D(0, 0, 1)) {
+		t.Fatalf("z should be the most significant dimension in 3D")
+	}
+	// a 2x2 aligned square covers four consecutive codes
+	if c, _ := FromMorton2D(3, 3).uint64Bits(); c != 15 {
+		t.Fatalf("(3,3) should be the last code of the 4x4 square, got %d", c)
+	}
+}
+
+func TestMortonRangesCoverExactlyTheBox(t *testing.T) {
+	rng := rand.New(rand.NewSource(10))
+	for i := 0; i < 300; i++ {
+		minX, minY := uint32(rng.Intn(16)), uint32(rng.Intn(16))
+		maxX, maxY := minX+uint32(rng.Intn(16)), minY+uint32(rng.Intn(16))
+		ranges, exact := mortonRanges2D(minX, minY, maxX, maxY, 1<<20)
+		if !exact {
+			t.Fatalf("box (%d,%d)-(%d,%d) should fit into the limit", minX, minY, maxX, maxY)
+		}
+		for j := 1; j < len(ranges); j++ {
+			if ranges[j-1].to+1 >= ranges[j].from {
+				t.Fatalf("ranges %v and %v should be ascending, disjoint and not adjacent", ranges[j-1], ranges[j])
+			}
+		}
+		for x := uint32(0); x < 32; x++ {
+			for y := uint32(0); y < 32; y++ {
+				code := morton2D(x, y)
+				covered := false
+				for _, r := range ranges {
+					covered = covered || (r.from <= code && code <= r.to)
+				}
+				inside := minX <= x && x <= maxX && minY <= y && y <= maxY
+				if covered != inside {
+					t.Fatalf("box (%d,%d)-(%d,%d): point (%d,%d) covered=%v, inside=%v", minX, minY, maxX, maxY, x, y, covered, inside)
+				}
+			}
+		}
+	}
+}
+
+func TestMortonRangesEdgeCases(t *testing.T) {
+	if r, _ := mortonRanges2D(0, 0, math.MaxUint32, math.MaxUint32, maxMortonRanges); len(r) != 1 || r[0] != (zRange{0, math.MaxUint64}) {
+		t.Fatalf("the whole plane should be one range, got %v", r)
+	}
+	if r, _ := mortonRanges2D(0, 0, 1023, 1023, maxMortonRanges); len(r) != 1 || r[0] != (zRange{0, 1<<20 - 1}) {
+		t.Fatalf("an aligned square should be one range, got %v", r)
+	}
+	if r, _ := mortonRanges2D(math.MaxUint32, math.MaxUint32, math.MaxUint32, math.MaxUint32, maxMortonRanges); len(r) != 1 || r[0].from != math.MaxUint64 {
+		t.Fatalf("the corner point should be one range, got %v", r)
+	}
+}
+
+func TestMortonRangesAreCapped(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	for i := 0; i < 300; i++ {
+		minX, minY := uint32(rng.Intn(64)), uint32(rng.Intn(64))
+		maxX, maxY := minX+uint32(rng.Intn(64)), minY+uint32(rng.Intn(64))
+		ranges, _ := mortonRanges2D(minX, minY, maxX, maxY, 4)
+		if len(ranges) > 4 {
+			t.Fatalf("box (%d,%d)-(%d,%d): %d ranges exceed the limit", minX, minY, maxX, maxY, len(ranges))
+		}
+		// the ranges must still cover every point of the box
+		for x := minX; x <= maxX; x++ {
+			for y := minY; y <= maxY; y++ {
+				code := morton2D(x, y)
+				covered := false
+				for _, r := range ranges {
+					covered = covered || (r.from <= code && code <= r.to)
+				}
+				if !covered {
+					t.Fatalf("box (%d,%d)-(%d,%d): point (%d,%d) not covered", minX, minY, maxX, maxY, x, y)
+				}
+			}
+		}
+	}
+	// a one-column box over the full height needs 2^32 exact ranges
+	if r, exact := mortonRanges2D(1, 0, 1, math.MaxUint32, maxMortonRanges); exact || len(r) > maxMortonRanges {
+		t.Fatalf("a tall column should yield at most %d approximate ranges, got %d (exact=%v)", maxMortonRanges, len(r), exact)
+	}
+}
+
+func TestValuesInBoxThinAndTall(t *testing.T) {
+	mm := New[int]()
+	want := set3.Empty[int]()
+	for i := uint32(0); i < 200; i++ {
+		y := i * (math.MaxUint32 / 200)
+		for x := uint32(0); x < 3; x++ {
+			mm.AddValue(FromMorton2D(x, y), int(i*10+x))
+			if x == 1 {
+				want.Add(int(i*10 + x))
+			}
+		}
+	}
+	mm.AddValue(FromString("not a Morton key"), -1)
+	if got := ValuesInBox(mm, 1, 0, 1, math.MaxUint32); !got.Equals(want) {
+		t.Fatalf("ValuesInBox returned %d values, want %d", got.Size(), want.Size())
+	}
+	if got := ValuesInBox(mm, 1, 0, 1, 1<<20); !got.Equals(set3.From(1)) {
+		t.Fatalf("ValuesInBox returned %v, want [1]", got.ToArray())
+	}
+}
+
+func TestValuesInBox(t *testing.T) {
+	mm := New[int]()
+	for x := uint32(0); x < 20; x++ {
+		for y := uint32(0); y < 20; y++ {
+			mm.AddValue(FromMorton2D(x, y), int(x*100+y))
+		}
+	}
+	want := set3.Empty[int]()
+	for x := 3; x <= 9; x++ {
+		for y := 5; y <= 6; y++ {
+			want.Add(x*100 + y)
+		}
+	}
+	if got := ValuesInBox(mm, 3, 5, 9, 6); !got.Equals(want) {
+		t.Fatalf("ValuesInBox returned %d values, want %d", got.Size(), want.Size())
+	}
+	if got := ValuesInBox(mm, 9, 5, 3, 6); got == nil || got.Size() != 0 {
+		t.Fatalf("an empty box should return an empty set")
+	}
+}
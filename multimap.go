@@ -1,6 +1,8 @@
 // Package multimap provides a simple, thread-safe multi-map keyed by Key objects.
 // The default implementation is array-based. This file defines the generic
 // MultiMap interface and constructors allowing future alternative implementations.
+// An implementation backed by an adaptive radix tree is available via
+// `art.NewART` in the `art` subpackage.
 //
 // Keys are compared using `Key.LessThan`, which performs a byte-wise lexicographic
 // comparison of the underlying `[]byte` representation. Range queries and ordering
@@ -13,6 +15,8 @@
 package multimap
 
 import (
+	"iter"
+
 	set3 "github.com/TomTonic/Set3"
 )
 
@@ -82,19 +86,128 @@ type MultiMap[T comparable] interface {
 	// copy and can thus be safely mutated by the caller.
 	ValuesToExclusive(to Key) *set3.Set3[T]
 
+	// ValuesWithPrefix returns a set with all values whose keys start with the bytes of
+	// prefix, including values stored for prefix itself. An empty prefix matches all
+	// keys. This function always returns a non-nil set. The result set is an
+	// independent copy and can thus be safely mutated by the caller.
+	ValuesWithPrefix(prefix Key) *set3.Set3[T]
+
 	// AllValues returns a set with all values currently stored in the multi-map.
 	// If no values are stored, this function returns an empty set. This function always returns a non-nil set.
 	// The result set is an independent copy and can thus be safely mutated by the caller.
 	AllValues() *set3.Set3[T]
 
+	// Floor returns the greatest stored key that is less than or equal to key,
+	// together with its set of values. Comparisons use `Key.LessThanOrEqual`. If
+	// no such key exists, found is false, the returned key is nil and the set is
+	// empty. The returned set is never nil; key and set are independent copies.
+	Floor(key Key) (floor Key, values *set3.Set3[T], found bool)
+
+	// Ceiling returns the smallest stored key that is greater than or equal to
+	// key, together with its set of values. It behaves like Floor otherwise.
+	Ceiling(key Key) (ceiling Key, values *set3.Set3[T], found bool)
+
+	// Lower returns the greatest stored key that is strictly less than key,
+	// together with its set of values. It behaves like Floor otherwise.
+	Lower(key Key) (lower Key, values *set3.Set3[T], found bool)
+
+	// Higher returns the smallest stored key that is strictly greater than key,
+	// together with its set of values. It behaves like Floor otherwise.
+	Higher(key Key) (higher Key, values *set3.Set3[T], found bool)
+
+	// LongestPrefixMatch returns the longest stored key that is a prefix of key,
+	// including key itself, together with its set of values. Combined with
+	// FromPrefix and FromAddr it finds the most specific CIDR containing an
+	// address. If no stored key is a prefix of key, found is false, the returned
+	// key is nil and the set is empty. The returned set is never nil; key and set
+	// are independent copies.
+	LongestPrefixMatch(key Key) (prefix Key, values *set3.Set3[T], found bool)
+
+	// FirstKey returns the smallest stored key according to `Key.LessThan`. If the
+	// MultiMap is empty, found is false and the returned key is nil. The returned
+	// key is a clone.
+	FirstKey() (first Key, found bool)
+
+	// LastKey returns the greatest stored key according to `Key.LessThan`. It
+	// behaves like FirstKey otherwise.
+	LastKey() (last Key, found bool)
+
+	// PopFirst removes the smallest stored key and returns it together with its
+	// set of values. Finding and removing the key is a single atomic operation, so
+	// concurrent callers never pop the same key. If the MultiMap is empty, found is
+	// false, the returned key is nil and the set is empty; the set is never nil.
+	PopFirst() (first Key, values *set3.Set3[T], found bool)
+
+	// PopLast removes the greatest stored key and returns it together with its
+	// set of values. It behaves like PopFirst otherwise.
+	PopLast() (last Key, values *set3.Set3[T], found bool)
+
 	// NumberOfKeys returns the number of keys currently stored in the map.
 	NumberOfKeys() uint64
 
-	// AllKeys returns a slice with all keys currently stored in the map. Returned
-	// keys are clones and can be safely mutated by the caller. The order of keys is
-	// implementation-defined and should not be relied upon.
+	// AllKeys returns a slice with all keys currently stored in the map, sorted in
+	// ascending order according to `Key.LessThan`. Every implementation guarantees
+	// this order, so the result can be used for ordered listings and merge joins
+	// without sorting it again. Returned keys are clones and can be safely mutated
+	// by the caller.
 	AllKeys() []Key
 
+	// All returns an iterator over all keys and their sets of values, in ascending
+	// key order like AllKeys. Yielded keys and sets are independent copies. The iterator
+	// does not hold a lock while the loop body runs, so the body may call any
+	// method of the MultiMap, including modifying ones; keys added or removed
+	// during the iteration may or may not be yielded.
+	All() iter.Seq2[Key, *set3.Set3[T]]
+
+	// Keys returns an iterator over all keys, in ascending key order like AllKeys.
+	// Yielded keys are clones. Concurrent modifications behave as for All.
+	Keys() iter.Seq[Key]
+
+	// KeysWithPrefix returns an iterator over all keys that start with the bytes of
+	// prefix, including prefix itself, in ascending key order. Yielded keys are
+	// clones. Concurrent modifications behave as for All.
+	KeysWithPrefix(prefix Key) iter.Seq[Key]
+
+	// Values returns an iterator over the values of all keys, key by key in
+	// ascending key order like AllKeys. A value stored for several keys is yielded once per
+	// key; use AllValues for a de-duplicated set. Concurrent modifications behave
+	// as for All.
+	Values() iter.Seq[T]
+
+	// Range returns an iterator over all keys between from and to and their sets
+	// of values, in ascending key order like AllKeys. If inclusive is true, from and to
+	// themselves are part of the range. Comparisons use `Key.LessThan`. If `from`
+	// is greater than `to`, nothing is yielded. Yielded keys and sets are
+	// independent copies. Concurrent modifications behave as for All.
+	Range(from, to Key, inclusive bool) iter.Seq2[Key, *set3.Set3[T]]
+
+	// EntriesBetweenInclusive returns an iterator over all keys between from and to,
+	// including from and to, together with their sets of values. Keys are yielded in
+	// ascending order, so each value can be attributed to the key it is stored for.
+	// Comparisons use `Key.LessThan`. If `from` is greater than `to`, nothing is
+	// yielded. Yielded keys and sets are independent copies. Concurrent
+	// modifications behave as for All.
+	EntriesBetweenInclusive(from, to Key) iter.Seq2[Key, *set3.Set3[T]]
+
+	// EntriesBetweenExclusive is like EntriesBetweenInclusive but excludes from and to.
+	EntriesBetweenExclusive(from, to Key) iter.Seq2[Key, *set3.Set3[T]]
+
+	// EntriesFromInclusive returns an iterator over all keys greater than or equal to
+	// from and their sets of values, in ascending key order. Yielded keys and sets
+	// are independent copies. Concurrent modifications behave as for All.
+	EntriesFromInclusive(from Key) iter.Seq2[Key, *set3.Set3[T]]
+
+	// EntriesFromExclusive is like EntriesFromInclusive but excludes from.
+	EntriesFromExclusive(from Key) iter.Seq2[Key, *set3.Set3[T]]
+
+	// EntriesToInclusive returns an iterator over all keys less than or equal to to
+	// and their sets of values, in ascending key order. Yielded keys and sets are
+	// independent copies. Concurrent modifications behave as for All.
+	EntriesToInclusive(to Key) iter.Seq2[Key, *set3.Set3[T]]
+
+	// EntriesToExclusive is like EntriesToInclusive but excludes to.
+	EntriesToExclusive(to Key) iter.Seq2[Key, *set3.Set3[T]]
+
 	// RemoveValue removes value v from the set of values at key. Removing a non-existent
 	// key or value is a no-op. If the set becomes empty the key may be removed.
 	RemoveValue(key Key, v T)
@@ -310,3 +310,236 @@ func TestRangeQueriesWithNegativeInts(t *testing.T) {
 		t.Fatalf("FromInclusive(-4) expected %v got %v", want, res)
 	}
 }
+
+func TestIteratorsYieldAllEntries(t *testing.T) {
+	mm := New[int]()
+	mm.AddValue(FromString("a"), 1)
+	mm.AddValue(FromString("a"), 2)
+	mm.AddValue(FromString("b"), 2)
+	mm.AddValue(FromString("c"), 3)
+
+	seen := map[string]*set3.Set3[int]{}
+	for k, vals := range mm.All() {
+		seen[string(k)] = vals
+	}
+	if len(seen) != 3 || !seen["a"].Equals(set3.From(1, 2)) || !seen["c"].Equals(set3.From(3)) {
+		t.Fatalf("All() yielded unexpected entries")
+	}
+
+	keys := 0
+	for range mm.Keys() {
+		keys++
+	}
+	if keys != 3 {
+		t.Fatalf("Keys() yielded %d keys, want 3", keys)
+	}
+
+	// value 2 is stored for a and b and is yielded once per key
+	values := []int{}
+	for v := range mm.Values() {
+		values = append(values, v)
+	}
+	if len(values) != 4 {
+		t.Fatalf("Values() yielded %v, want 4 values", values)
+	}
+}
+
+func TestRangeIterator(t *testing.T) {
+	mm := New[int]()
+	mm.AddValue(FromString("a"), 1)
+	mm.AddValue(FromString("b"), 2)
+	mm.AddValue(FromString("c"), 3)
+
+	collect := func(from, to Key, inclusive bool) *set3.Set3[int] {
+		result := set3.Empty[int]()
+		for _, vals := range mm.Range(from, to, inclusive) {
+			result.AddAll(vals)
+		}
+		return result
+	}
+	if res := collect(FromString("a"), FromString("c"), true); !res.Equals(set3.From(1, 2, 3)) {
+		t.Fatalf("Range(a,c,inclusive) = %v", res)
+	}
+	if res := collect(FromString("a"), FromString("c"), false); !res.Equals(set3.From(2)) {
+		t.Fatalf("Range(a,c,exclusive) = %v", res)
+	}
+	if res := collect(FromString("c"), FromString("a"), true); res.Size() != 0 {
+		t.Fatalf("Range(c,a) expected empty, got %v", res)
+	}
+}
+
+func TestIteratorsAllowModificationAndEarlyStop(t *testing.T) {
+	mm := New[int]()
+	for i := 0; i < 10; i++ {
+		mm.AddValue(FromInt(i), i)
+	}
+	n := 0
+	for k, vals := range mm.All() {
+		// modifying the map from within the loop must not deadlock
+		mm.RemoveKey(k)
+		vals.Add(100) // yielded sets are copies
+		n++
+		if n == 4 {
+			break
+		}
+	}
+	if n != 4 || mm.NumberOfKeys() != 6 {
+		t.Fatalf("expected to stop after 4 keys and remove them, got n=%d keys=%d", n, mm.NumberOfKeys())
+	}
+	if mm.AllValues().Contains(100) {
+		t.Fatalf("modifying a yielded set changed the map")
+	}
+}
+
+func TestAllKeysSortedAfterRemoveKey(t *testing.T) {
+	mm := New[int]()
+	for _, s := range []string{"d", "a", "c", "ab", "e", "b", ""} {
+		mm.AddValue(FromString(s), len(s))
+	}
+	mm.RemoveKey(FromString("a"))
+	mm.RemoveKey(FromString("e"))
+	mm.AddValue(FromString("aa"), 2)
+
+	want := []string{"", "aa", "ab", "b", "c", "d"}
+	keys := mm.AllKeys()
+	if len(keys) != len(want) {
+		t.Fatalf("expected %d keys, got %d", len(want), len(keys))
+	}
+	i := 0
+	for k := range mm.Keys() {
+		if !keys[i].Equal(FromString(want[i])) || !k.Equal(keys[i]) {
+			t.Fatalf("key %d: AllKeys=%v Keys=%v, want %q", i, keys[i], k, want[i])
+		}
+		i++
+	}
+}
+
+func TestEntriesKeepValuesGroupedByKey(t *testing.T) {
+	mm := New[int]()
+	for i := 0; i < 30; i++ {
+		mm.AddValue(FromInt(i/10), i) // three buckets of ten values each
+	}
+
+	bucket := 0
+	for k, vals := range mm.EntriesBetweenInclusive(FromInt(0), FromInt(1)) {
+		if !k.Equal(FromInt(bucket)) || vals.Size() != 10 || !vals.Contains(bucket*10) {
+			t.Fatalf("bucket %d: got key %v with %d values", bucket, k, vals.Size())
+		}
+		bucket++
+	}
+	if bucket != 2 {
+		t.Fatalf("expected buckets 0 and 1, got %d buckets", bucket)
+	}
+
+	tests := []struct {
+		name string
+		got  func() int
+		want int
+	}{
+		{"BetweenExclusive(0,2)", func() int { return count(mm.EntriesBetweenExclusive(FromInt(0), FromInt(2))) }, 1},
+		{"FromInclusive(1)", func() int { return count(mm.EntriesFromInclusive(FromInt(1))) }, 2},
+		{"FromExclusive(1)", func() int { return count(mm.EntriesFromExclusive(FromInt(1))) }, 1},
+		{"ToInclusive(1)", func() int { return count(mm.EntriesToInclusive(FromInt(1))) }, 2},
+		{"ToExclusive(1)", func() int { return count(mm.EntriesToExclusive(FromInt(1))) }, 1},
+		{"BetweenInclusive(2,0)", func() int { return count(mm.EntriesBetweenInclusive(FromInt(2), FromInt(0))) }, 0},
+	}
+	for _, tc := range tests {
+		if got := tc.got(); got != tc.want {
+			t.Fatalf("%s yielded %d keys, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+// count returns the number of pairs yielded by seq.
+func count[K, V any](seq func(yield func(K, V) bool)) int {
+	n := 0
+	for range seq {
+		n++
+	}
+	return n
+}
+
+func TestPrefixQueries(t *testing.T) {
+	mm := New[string]()
+	for _, s := range []string{"tenant", "tenant/a", "tenant/a/x", "tenant/b", "tenant0", "other"} {
+		mm.AddValue(FromString(s), s)
+	}
+	if res := mm.ValuesWithPrefix(FromString("tenant/")); !res.Equals(set3.From("tenant/a", "tenant/a/x", "tenant/b")) {
+		t.Fatalf("ValuesWithPrefix(tenant/) = %v", res)
+	}
+	if res := mm.ValuesWithPrefix(FromString("tenant/a")); !res.Equals(set3.From("tenant/a", "tenant/a/x")) {
+		t.Fatalf("ValuesWithPrefix(tenant/a) should include the prefix itself, got %v", res)
+	}
+	if res := mm.ValuesWithPrefix(FromString("x")); res == nil || res.Size() != 0 {
+		t.Fatalf("ValuesWithPrefix(x) should be an empty set, got %v", res)
+	}
+	var keys []string
+	for k := range mm.KeysWithPrefix(FromString("tenant")) {
+		keys = append(keys, string(k))
+	}
+	if len(keys) != 5 || keys[0] != "tenant" || keys[4] != "tenant0" {
+		t.Fatalf("KeysWithPrefix(tenant) = %v", keys)
+	}
+}
+
+func TestFloorCeilingLowerHigher(t *testing.T) {
+	mm := New[string]()
+	mm.AddValue(FromInt64(0), "basic")
+	mm.AddValue(FromInt64(100), "silver")
+	mm.AddValue(FromInt64(1000), "gold")
+
+	if k, tier, ok := mm.Floor(FromInt64(250)); !ok || !k.Equal(FromInt64(100)) || !tier.Equals(set3.From("silver")) {
+		t.Fatalf("Floor(250) = %v %v %v, want silver", k, tier, ok)
+	}
+	if k, tier, ok := mm.Ceiling(FromInt64(250)); !ok || !k.Equal(FromInt64(1000)) || !tier.Equals(set3.From("gold")) {
+		t.Fatalf("Ceiling(250) = %v %v %v, want gold", k, tier, ok)
+	}
+	if k, _, ok := mm.Lower(FromInt64(100)); !ok || !k.Equal(FromInt64(0)) {
+		t.Fatalf("Lower(100) = %v %v, want 0", k, ok)
+	}
+	if k, _, ok := mm.Higher(FromInt64(100)); !ok || !k.Equal(FromInt64(1000)) {
+		t.Fatalf("Higher(100) = %v %v, want 1000", k, ok)
+	}
+	if _, tier, ok := mm.Floor(FromInt64(-1)); ok || tier == nil || tier.Size() != 0 {
+		t.Fatalf("Floor(-1) should not find a key and return an empty set")
+	}
+	if _, _, ok := mm.Higher(FromInt64(1000)); ok {
+		t.Fatalf("Higher(1000) should not find a key")
+	}
+}
+
+func TestPopFirstAsWorkQueue(t *testing.T) {
+	mm := New[string]()
+	mm.AddValue(FromInt64(300), "late")
+	mm.AddValue(FromInt64(100), "early")
+	mm.AddValue(FromInt64(100), "early too")
+
+	if k, ok := mm.LastKey(); !ok || !k.Equal(FromInt64(300)) {
+		t.Fatalf("LastKey = %v, want 300", k)
+	}
+	k, jobs, ok := mm.PopFirst()
+	if !ok || !k.Equal(FromInt64(100)) || !jobs.Equals(set3.From("early", "early too")) {
+		t.Fatalf("PopFirst = %v %v, want both jobs due at 100", k, jobs)
+	}
+	if k, ok := mm.FirstKey(); !ok || !k.Equal(FromInt64(300)) {
+		t.Fatalf("FirstKey after PopFirst = %v, want 300", k)
+	}
+}
+
+func TestPopLastReleasesTheEntry(t *testing.T) {
+	m := newArrayBased[string]()
+	m.AddValue(FromInt64(1), "a")
+	m.AddValue(FromInt64(2), "b")
+	if k, _, ok := m.PopLast(); !ok || !k.Equal(FromInt64(2)) {
+		t.Fatalf("PopLast = %v %v, want 2", k, ok)
+	}
+	if vacated := m.data[:2][1]; vacated.key != nil || vacated.val != nil {
+		t.Fatalf("PopLast should zero the vacated slot, got %v", vacated)
+	}
+	if _, _, ok := m.PopLast(); !ok {
+		t.Fatalf("PopLast should find the remaining key")
+	}
+	if _, _, ok := m.PopLast(); ok {
+		t.Fatalf("PopLast on an empty map should not find a key")
+	}
+}
@@ -0,0 +1,99 @@
+package multimap
+
+import (
+	"errors"
+	"net/netip"
+)
+
+// Address and prefix keys
+// -----------------------
+// FromAddr and FromPrefix store one byte (0x00 or 0x01) per address bit,
+// after a byte for the address family (0x04 for IPv4, 0x06 for IPv6). A CIDR
+// prefix of n bits thus becomes a Key of 1+n bytes that is a byte-wise prefix
+// of the keys of exactly the addresses and prefixes it contains, so
+// MultiMap.LongestPrefixMatch respects the bit-level prefix length and
+// MultiMap.KeysWithPrefix lists everything inside a CIDR. Keys are ordered by
+// family, then numerically, with a prefix directly before the addresses it
+// contains.
+const (
+	familyIPv4 byte = 0x04
+	familyIPv6 byte = 0x06
+)
+
+// ErrInvalidAddr is returned when a Key is decoded as an address or prefix
+// but was not produced by FromAddr or FromPrefix.
+var ErrInvalidAddr = errors.New("multimap: key is not an address or prefix key")
+
+// FromAddr returns the Key of the IP address a. IPv4 and IPv6 addresses are
+// kept apart; use a.Unmap() first to treat IPv4-mapped IPv6 addresses as
+// IPv4. The zone of an IPv6 address is ignored. The zero Addr yields the
+// empty Key.
+func FromAddr(a netip.Addr) Key {
+	if !a.IsValid() {
+		return Key{}
+	}
+	return appendAddrBits(a, a.BitLen())
+}
+
+// FromPrefix returns the Key of the CIDR prefix p. Host bits of p are
+// ignored, so 10.1.2.3/8 yields the same Key as 10.0.0.0/8. An invalid
+// Prefix yields the empty Key.
+func FromPrefix(p netip.Prefix) Key {
+	if !p.IsValid() {
+		return Key{}
+	}
+	return appendAddrBits(p.Addr(), p.Bits())
+}
+
+// appendAddrBits returns the family byte of a followed by its first bits bits.
+func appendAddrBits(a netip.Addr, bits int) Key {
+	family := familyIPv6
+	if a.Is4() {
+		family = familyIPv4
+	}
+	k := make(Key, 1, 1+bits)
+	k[0] = family
+	raw := a.AsSlice()
+	for i := 0; i < bits; i++ {
+		k = append(k, raw[i/8]>>(7-i%8)&1)
+	}
+	return k
+}
+
+// Prefix decodes a Key produced by FromPrefix, or by FromAddr, which then
+// yields a single-address prefix such as 10.0.0.1/32. It returns
+// ErrInvalidAddr for any other Key.
+func (k Key) Prefix() (netip.Prefix, error) {
+	if len(k) == 0 {
+		return netip.Prefix{}, ErrInvalidAddr
+	}
+	var raw [16]byte
+	bitLen := 128
+	if k[0] == familyIPv4 {
+		bitLen = 32
+	} else if k[0] != familyIPv6 {
+		return netip.Prefix{}, ErrInvalidAddr
+	}
+	bits := k[1:]
+	if len(bits) > bitLen {
+		return netip.Prefix{}, ErrInvalidAddr
+	}
+	for i, b := range bits {
+		if b > 1 {
+			return netip.Prefix{}, ErrInvalidAddr
+		}
+		raw[i/8] |= b << (7 - i%8)
+	}
+	a, _ := netip.AddrFromSlice(raw[:bitLen/8])
+	return netip.PrefixFrom(a, len(bits)), nil
+}
+
+// Addr decodes a Key produced by FromAddr. It returns ErrInvalidAddr for any
+// other Key, including prefix keys shorter than a full address.
+func (k Key) Addr() (netip.Addr, error) {
+	p, err := k.Prefix()
+	if err != nil || p.Bits() != p.Addr().BitLen() {
+		return netip.Addr{}, ErrInvalidAddr
+	}
+	return p.Addr(), nil
+}
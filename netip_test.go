@@ -0,0 +1,92 @@
+package multimap
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	set3 "github.com/TomTonic/Set3"
+)
+
+func TestPrefixKeysRespectBitLength(t *testing.T) {
+	p := FromPrefix(netip.MustParsePrefix("10.128.0.0/9"))
+	if len(p) != 10 {
+		t.Fatalf("a /9 prefix should have 1+9 bytes, got %d", len(p))
+	}
+	if !FromAddr(netip.MustParseAddr("10.200.1.1")).HasPrefix(p) {
+		t.Fatalf("10.200.1.1 should be inside 10.128.0.0/9")
+	}
+	if FromAddr(netip.MustParseAddr("10.100.1.1")).HasPrefix(p) {
+		t.Fatalf("10.100.1.1 should not be inside 10.128.0.0/9")
+	}
+	if !FromPrefix(netip.MustParsePrefix("10.200.1.1/9")).Equal(p) {
+		t.Fatalf("host bits of a prefix should be ignored")
+	}
+	if FromAddr(netip.MustParseAddr("::ffff:10.0.0.1")).HasPrefix(FromPrefix(netip.MustParsePrefix("10.0.0.0/8"))) {
+		t.Fatalf("IPv4-mapped IPv6 addresses should not match IPv4 prefixes unless unmapped")
+	}
+}
+
+func TestAddrKeysOrdering(t *testing.T) {
+	ordered := []Key{
+		FromPrefix(netip.MustParsePrefix("0.0.0.0/0")),
+		FromPrefix(netip.MustParsePrefix("9.0.0.0/8")),
+		FromAddr(netip.MustParseAddr("9.255.255.255")),
+		FromPrefix(netip.MustParsePrefix("10.0.0.0/8")),
+		FromAddr(netip.MustParseAddr("10.0.0.1")),
+		FromAddr(netip.MustParseAddr("255.255.255.255")),
+		FromAddr(netip.MustParseAddr("::")),
+		FromAddr(netip.MustParseAddr("2001:db8::1")),
+	}
+	for i := 1; i < len(ordered); i++ {
+		if !ordered[i-1].LessThan(ordered[i]) {
+			t.Fatalf("expected key %d < key %d", i-1, i)
+		}
+	}
+}
+
+func TestAddrAndPrefixDecoding(t *testing.T) {
+	for _, s := range []string{"192.168.1.0/24", "10.128.0.0/9", "0.0.0.0/0", "2001:db8::/33", "::1/128"} {
+		p := netip.MustParsePrefix(s)
+		if got, err := FromPrefix(p).Prefix(); err != nil || got != p {
+			t.Fatalf("FromPrefix(%s).Prefix() = %v, %v", s, got, err)
+		}
+	}
+	a := netip.MustParseAddr("fe80::1%eth0")
+	if got, err := FromAddr(a).Addr(); err != nil || got != a.WithZone("") {
+		t.Fatalf("FromAddr(%v).Addr() = %v, %v", a, got, err)
+	}
+	for _, k := range []Key{{}, FromString("10.0.0.1"), {familyIPv4, 2}, FromPrefix(netip.MustParsePrefix("10.0.0.0/8"))} {
+		if _, err := k.Addr(); !errors.Is(err, ErrInvalidAddr) {
+			t.Fatalf("Addr(%v): expected ErrInvalidAddr, got %v", k, err)
+		}
+	}
+	if len(FromAddr(netip.Addr{})) != 0 || len(FromPrefix(netip.Prefix{})) != 0 {
+		t.Fatalf("invalid addresses and prefixes should yield the empty key")
+	}
+}
+
+func TestLongestPrefixMatchRoutingTable(t *testing.T) {
+	mm := New[string]()
+	mm.AddValue(FromPrefix(netip.MustParsePrefix("0.0.0.0/0")), "default")
+	mm.AddValue(FromPrefix(netip.MustParsePrefix("10.0.0.0/8")), "internal")
+	mm.AddValue(FromPrefix(netip.MustParsePrefix("10.128.0.0/9")), "dmz")
+
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"8.8.8.8", "default"},
+		{"10.1.2.3", "internal"},
+		{"10.200.0.1", "dmz"},
+	}
+	for _, tc := range tests {
+		_, rules, ok := mm.LongestPrefixMatch(FromAddr(netip.MustParseAddr(tc.addr)))
+		if !ok || !rules.Equals(set3.From(tc.want)) {
+			t.Fatalf("LongestPrefixMatch(%s) = %v, want %s", tc.addr, rules, tc.want)
+		}
+	}
+	if _, rules, ok := mm.LongestPrefixMatch(FromAddr(netip.MustParseAddr("::1"))); ok || rules.Size() != 0 {
+		t.Fatalf("IPv6 addresses should not match IPv4 prefixes")
+	}
+}
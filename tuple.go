@@ -0,0 +1,391 @@
+package multimap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Tuple encoding
+// --------------
+// A tuple Key is the concatenation of its encoded elements. Every element
+// starts with a type code followed by the encoded value:
+//
+//	0x01 byte string: bytes with 0x00 escaped as 0x00 0xFF, terminated by 0x00
+//	0x02 string:      NFC-normalized UTF-8, escaped and terminated like 0x01
+//	0x15 integer:     8 bytes, encoded like FromInt64
+//	0x16 unsigned:    8 bytes, plain big-endian uint64
+//	0x21 float:       8 bytes, encoded like FromFloat64
+//	0x40 descending:  a Key encoded like Key.Descending, which is self-terminating
+//
+// The terminator 0x00 sorts before every byte a longer value could continue
+// with, and the escape byte 0xFF sorts after every type code, so byte-wise
+// comparison of two tuple Keys equals element-wise comparison of the tuples:
+// ("ab", 9) < ("abc", 1) holds, and a tuple sorts directly before all tuples
+// it is a prefix of. Elements of different types at the same position are
+// ordered by type code, so signed integers sort before unsigned ones; use
+// one of them per position. Unsigned integers have their own type code since
+// adding the 1<<63 offset of signed ones would wrap values of 2^63 and above.
+// As this is the scheme of the FoundationDB tuple
+// layer, Keys of tuples with a common prefix can be found with
+// MultiMap.KeysWithPrefix.
+const (
+	tupleBytes  byte = 0x01
+	tupleString byte = 0x02
+	tupleInt    byte = 0x15
+	tupleUint   byte = 0x16
+	tupleFloat  byte = 0x21
+	tupleDesc   byte = 0x40
+
+	tupleTerminator byte = 0x00
+	tupleEscape     byte = 0xFF
+)
+
+// ErrInvalidTuple is returned when a Key cannot be decoded as a tuple, either
+// because it was not built as one or because an element has another type than
+// requested.
+var ErrInvalidTuple = errors.New("multimap: key is not a valid tuple")
+
+// KeyBuilder builds a composite Key from several elements, for example
+// (tenant string, ts int64, id uint32), whose byte order equals the
+// element-wise order of the tuples. The zero value is ready to use. All Add
+// methods return the builder to allow chaining:
+//
+//	k := new(KeyBuilder).AddString(tenant).AddTime(ts).AddUint64(uint64(id)).Key()
+type KeyBuilder struct {
+	key Key
+}
+
+// NewKeyBuilder returns an empty KeyBuilder.
+func NewKeyBuilder() *KeyBuilder { return &KeyBuilder{} }
+
+// AddString appends s as a string element. Like FromString, s is normalized
+// to Unicode NFC.
+func (b *KeyBuilder) AddString(s string) *KeyBuilder {
+	b.key = appendEscaped(append(b.key, tupleString), []byte(norm.NFC.String(s)))
+	return b
+}
+
+// AddBytes appends p as a byte string element.
+func (b *KeyBuilder) AddBytes(p []byte) *KeyBuilder {
+	b.key = appendEscaped(append(b.key, tupleBytes), p)
+	return b
+}
+
+// AddInt64 appends i as an integer element.
+func (b *KeyBuilder) AddInt64(i int64) *KeyBuilder {
+	b.key = binary.BigEndian.AppendUint64(append(b.key, tupleInt), uint64(i)+1<<63)
+	return b
+}
+
+// AddUint64 appends u as an unsigned integer element. Unsigned elements have
+// their own type code and sort after all signed ones, so AddUint64(0) differs
+// from AddInt64(0).
+func (b *KeyBuilder) AddUint64(u uint64) *KeyBuilder {
+	b.key = binary.BigEndian.AppendUint64(append(b.key, tupleUint), u)
+	return b
+}
+
+// AddFloat64 appends f as a float element, encoded like FromFloat64.
+func (b *KeyBuilder) AddFloat64(f float64) *KeyBuilder {
+	b.key = binary.BigEndian.AppendUint64(append(b.key, tupleFloat), float64Bits(f))
+	return b
+}
+
+// AddDescending appends k as a descending element: tuples that are equal up
+// to this element are ordered by k in reverse, while the other elements keep
+// ascending. For example, AddString(user).AddDescending(FromTime(ts)) lists the
+// newest events of a user first.
+func (b *KeyBuilder) AddDescending(k Key) *KeyBuilder {
+	b.key = appendDescending(append(b.key, tupleDesc), k)
+	return b
+}
+
+// AddTime appends t as an integer element holding its nanoseconds since the
+// Unix epoch, like FromTime.
+func (b *KeyBuilder) AddTime(t time.Time) *KeyBuilder {
+	return b.AddInt64(unixNano(t))
+}
+
+// Key returns the Key built so far. The builder can be used further; later
+// Add calls do not change Keys returned earlier.
+func (b *KeyBuilder) Key() Key {
+	return FromBytes(b.key)
+}
+
+// appendEscaped appends p to dst with every 0x00 escaped as 0x00 0xFF,
+// followed by the terminator 0x00.
+func appendEscaped(dst, p []byte) []byte {
+	for _, c := range p {
+		dst = append(dst, c)
+		if c == tupleTerminator {
+			dst = append(dst, tupleEscape)
+		}
+	}
+	return append(dst, tupleTerminator)
+}
+
+// Tuple is the decoded form of a tuple Key. Its elements have the types
+// string, []byte, int64, uint64, float64 and Desc.
+type Tuple []any
+
+// Desc marks a Key as a descending tuple element, see
+// KeyBuilder.AddDescending. For example, FromTuple(user, Desc(FromTime(ts)))
+// sorts the events of a user from newest to oldest.
+type Desc Key
+
+// FromTuple returns the tuple Key of elems, as if each element was added to a
+// KeyBuilder. Supported element types are string, []byte, Key (added as byte
+// string), all signed and unsigned integer types, float32, float64,
+// time.Time and Desc. FromTuple panics on any other type.
+func FromTuple(elems ...any) Key {
+	k, err := tupleKey(elems)
+	if err != nil {
+		panic("multimap: " + err.Error())
+	}
+	return k
+}
+
+// tupleKey is FromTuple returning an error for unsupported element types.
+func tupleKey(elems []any) (Key, error) {
+	b := NewKeyBuilder()
+	for i, e := range elems {
+		switch v := e.(type) {
+		case string:
+			b.AddString(v)
+		case []byte:
+			b.AddBytes(v)
+		case Key:
+			b.AddBytes(v)
+		case int:
+			b.AddInt64(int64(v))
+		case int8:
+			b.AddInt64(int64(v))
+		case int16:
+			b.AddInt64(int64(v))
+		case int32:
+			b.AddInt64(int64(v))
+		case int64:
+			b.AddInt64(v)
+		case uint:
+			b.AddUint64(uint64(v))
+		case uint8:
+			b.AddUint64(uint64(v))
+		case uint16:
+			b.AddUint64(uint64(v))
+		case uint32:
+			b.AddUint64(uint64(v))
+		case uint64:
+			b.AddUint64(v)
+		case float32:
+			b.AddFloat64(float64(v))
+		case float64:
+			b.AddFloat64(v)
+		case time.Time:
+			b.AddTime(v)
+		case Desc:
+			b.AddDescending(Key(v))
+		default:
+			return nil, fmt.Errorf("unsupported tuple element %d of type %T", i, e)
+		}
+	}
+	return b.key, nil
+}
+
+// MarshalText implements encoding.TextMarshaler. It returns the tuple Key of
+// t as text, see Key.MarshalText, so the element types survive a JSON round
+// trip, which would turn int64 elements into float64 and []byte elements
+// into strings. It returns an error if t has an element of a type FromTuple
+// does not support.
+func (t Tuple) MarshalText() ([]byte, error) {
+	k, err := tupleKey(t)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTuple, err)
+	}
+	return k.MarshalText()
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It decodes the output
+// of MarshalText with Key.Tuple, so the elements have the types documented
+// there.
+func (t *Tuple) UnmarshalText(text []byte) error {
+	var k Key
+	if err := k.UnmarshalText(text); err != nil {
+		return err
+	}
+	decoded, err := k.Tuple()
+	if err != nil {
+		return err
+	}
+	*t = decoded
+	return nil
+}
+
+// Tuple decodes a Key built by KeyBuilder or FromTuple into its elements.
+// Signed integer elements are returned as int64, unsigned ones as uint64,
+// float elements as float64 and
+// descending elements as Desc holding the original Key. It returns
+// ErrInvalidTuple if k is not a valid tuple Key.
+func (k Key) Tuple() (Tuple, error) {
+	var result Tuple
+	r := NewTupleReader(k)
+	for !r.Done() {
+		var e any
+		var err error
+		switch r.rest[0] {
+		case tupleBytes:
+			e, err = r.ReadBytes()
+		case tupleString:
+			e, err = r.ReadString()
+		case tupleInt:
+			e, err = r.ReadInt64()
+		case tupleUint:
+			e, err = r.ReadUint64()
+		case tupleFloat:
+			e, err = r.ReadFloat64()
+		case tupleDesc:
+			var d Key
+			d, err = r.ReadDescending()
+			e = Desc(d)
+		default:
+			err = fmt.Errorf("%w: unknown type code 0x%02X at element %d", ErrInvalidTuple, r.rest[0], r.index)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+// TupleReader decodes the elements of a tuple Key one by one when their types
+// are known, for example
+//
+//	r := NewTupleReader(k)
+//	tenant, _ := r.ReadString()
+//	ts, _ := r.ReadTime()
+//
+// Every Read method returns ErrInvalidTuple if the next element is missing,
+// malformed or of another type, and does not advance the reader in that case.
+type TupleReader struct {
+	rest  Key
+	index int
+}
+
+// NewTupleReader returns a TupleReader positioned at the first element of k.
+func NewTupleReader(k Key) *TupleReader { return &TupleReader{rest: k} }
+
+// Done reports whether all elements have been read.
+func (r *TupleReader) Done() bool { return len(r.rest) == 0 }
+
+// ReadString reads a string element.
+func (r *TupleReader) ReadString() (string, error) {
+	p, err := r.readEscaped(tupleString)
+	return string(p), err
+}
+
+// ReadBytes reads a byte string element.
+func (r *TupleReader) ReadBytes() ([]byte, error) {
+	return r.readEscaped(tupleBytes)
+}
+
+// ReadInt64 reads a signed integer element.
+func (r *TupleReader) ReadInt64() (int64, error) {
+	u, err := r.readFixed(tupleInt)
+	return int64(u - 1<<63), err
+}
+
+// ReadUint64 reads an unsigned integer element added with AddUint64.
+func (r *TupleReader) ReadUint64() (uint64, error) {
+	return r.readFixed(tupleUint)
+}
+
+// ReadFloat64 reads a float element.
+func (r *TupleReader) ReadFloat64() (float64, error) {
+	if err := r.peek(tupleFloat, 9); err != nil {
+		return 0, err
+	}
+	f, _ := Key(r.rest[1:9]).Float64()
+	r.advance(9)
+	return f, nil
+}
+
+// ReadDescending reads a descending element and returns the original Key
+// passed to AddDescending.
+func (r *TupleReader) ReadDescending() (Key, error) {
+	if err := r.peek(tupleDesc, 1); err != nil {
+		return nil, err
+	}
+	k, n, err := readDescending(r.rest[1:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: element %d is not a valid descending key", ErrInvalidTuple, r.index)
+	}
+	r.advance(1 + n)
+	return k, nil
+}
+
+// ReadTime reads an integer element added with AddTime. The result is in UTC.
+func (r *TupleReader) ReadTime() (time.Time, error) {
+	ns, err := r.ReadInt64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ns).UTC(), nil
+}
+
+// readFixed reads the 8 bytes of an integer element.
+func (r *TupleReader) readFixed(code byte) (uint64, error) {
+	if err := r.peek(code, 9); err != nil {
+		return 0, err
+	}
+	u := binary.BigEndian.Uint64(r.rest[1:9])
+	r.advance(9)
+	return u, nil
+}
+
+// readEscaped reads an escaped, terminated element and returns its unescaped
+// bytes.
+func (r *TupleReader) readEscaped(code byte) ([]byte, error) {
+	if err := r.peek(code, 1); err != nil {
+		return nil, err
+	}
+	result := []byte{}
+	for i := 1; i < len(r.rest); i++ {
+		c := r.rest[i]
+		if c != tupleTerminator {
+			result = append(result, c)
+			continue
+		}
+		if i+1 < len(r.rest) && r.rest[i+1] == tupleEscape {
+			result = append(result, tupleTerminator)
+			i++
+			continue
+		}
+		r.advance(i + 1)
+		return result, nil
+	}
+	return nil, fmt.Errorf("%w: element %d is not terminated", ErrInvalidTuple, r.index)
+}
+
+// peek checks that the next element has type code and at least size bytes
+// including the type code.
+func (r *TupleReader) peek(code byte, size int) error {
+	switch {
+	case r.Done():
+		return fmt.Errorf("%w: no element %d", ErrInvalidTuple, r.index)
+	case r.rest[0] != code:
+		return fmt.Errorf("%w: element %d has type code 0x%02X, not 0x%02X", ErrInvalidTuple, r.index, r.rest[0], code)
+	case len(r.rest) < size:
+		return fmt.Errorf("%w: element %d is truncated", ErrInvalidTuple, r.index)
+	}
+	return nil
+}
+
+// advance moves the reader past the current element of n bytes.
+func (r *TupleReader) advance(n int) {
+	r.rest = r.rest[n:]
+	r.index++
+}
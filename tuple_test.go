@@ -0,0 +1,194 @@
+package multimap
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTupleOrderingMatchesElementWiseOrder(t *testing.T) {
+	ordered := []Key{
+		FromTuple("a"),
+		FromTuple("a", int64(-1)),
+		FromTuple("a", int64(5)),
+		FromTuple("a\x00"),
+		FromTuple("a\x00", int64(0)),
+		FromTuple("ab", int64(9)),
+		FromTuple("abc", int64(1)),
+		FromTuple("b", math.Inf(-1)),
+		FromTuple("b", 0.5),
+	}
+	for i := 1; i < len(ordered); i++ {
+		if !ordered[i-1].LessThan(ordered[i]) {
+			t.Fatalf("expected tuple %d %v < tuple %d %v", i-1, ordered[i-1], i, ordered[i])
+		}
+	}
+}
+
+func TestTupleOrderingRandomStrings(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	randomString := func() string {
+		b := make([]byte, rng.Intn(4))
+		for i := range b {
+			b[i] = []byte{0x00, 0x01, 'a', 0xFF}[rng.Intn(4)]
+		}
+		return string(b)
+	}
+	for i := 0; i < 5000; i++ {
+		s1, s2 := randomString(), randomString()
+		i1, i2 := rng.Int63n(3)-1, rng.Int63n(3)-1
+		want := strings.Compare(s1, s2)
+		if want == 0 {
+			want = int(i1 - i2)
+		}
+		k1 := NewKeyBuilder().AddBytes([]byte(s1)).AddInt64(i1).Key()
+		k2 := NewKeyBuilder().AddBytes([]byte(s2)).AddInt64(i2).Key()
+		if got := k1.Compare(k2); (got < 0) != (want < 0) || (got == 0) != (want == 0) {
+			t.Fatalf("(%q,%d) vs (%q,%d): key order %d, element order %d", s1, i1, s2, i2, got, want)
+		}
+	}
+}
+
+func TestTupleRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	k := NewKeyBuilder().AddString("tenant\x00x").AddTime(ts).AddUint64(42).AddBytes(nil).AddFloat64(-2.5).Key()
+
+	got, err := k.Tuple()
+	want := Tuple{"tenant\x00x", ts.UnixNano(), uint64(42), []byte{}, -2.5}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Tuple() = %#v, %v; want %#v", got, err, want)
+	}
+
+	r := NewTupleReader(k)
+	tenant, err1 := r.ReadString()
+	when, err2 := r.ReadTime()
+	id, err3 := r.ReadUint64()
+	raw, err4 := r.ReadBytes()
+	f, err5 := r.ReadFloat64()
+	if err := errors.Join(err1, err2, err3, err4, err5); err != nil {
+		t.Fatalf("TupleReader failed: %v", err)
+	}
+	if tenant != "tenant\x00x" || !when.Equal(ts) || id != 42 || len(raw) != 0 || f != -2.5 || !r.Done() {
+		t.Fatalf("TupleReader decoded %q %v %d %v %v", tenant, when, id, raw, f)
+	}
+}
+
+func TestTupleUnsignedElements(t *testing.T) {
+	ordered := []uint64{0, 1, 1<<63 - 1, 1 << 63, math.MaxUint64}
+	for i := 1; i < len(ordered); i++ {
+		if !FromTuple(ordered[i-1]).LessThan(FromTuple(ordered[i])) {
+			t.Fatalf("FromTuple(%d) should sort before FromTuple(%d)", ordered[i-1], ordered[i])
+		}
+	}
+	for _, u := range ordered {
+		got, err := FromTuple("id", u).Tuple()
+		if err != nil || !reflect.DeepEqual(got, Tuple{"id", u}) {
+			t.Fatalf("Tuple() of %d = %#v, %v", u, got, err)
+		}
+	}
+	if FromTuple(uint64(1<<63)).Equal(FromTuple(int64(math.MinInt64))) || FromTuple(uint(0)).Equal(FromTuple(0)) {
+		t.Fatalf("unsigned and signed elements must not collide")
+	}
+	if !FromTuple(int64(math.MaxInt64)).LessThan(FromTuple(uint64(0))) {
+		t.Fatalf("signed elements should sort before unsigned ones")
+	}
+	if _, err := NewTupleReader(FromTuple(uint64(1))).ReadInt64(); !errors.Is(err, ErrInvalidTuple) {
+		t.Fatalf("ReadInt64 of an unsigned element: expected ErrInvalidTuple, got %v", err)
+	}
+}
+
+func TestFromTupleMatchesKeyBuilder(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	got := FromTuple("x", 1, int8(-2), uint32(3), float32(0.5), []byte{0}, Key{1}, ts)
+	want := NewKeyBuilder().AddString("x").AddInt64(1).AddInt64(-2).AddUint64(3).AddFloat64(0.5).
+		AddBytes([]byte{0}).AddBytes([]byte{1}).AddTime(ts).Key()
+	if !got.Equal(want) {
+		t.Fatalf("FromTuple = %v, want %v", got, want)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("FromTuple should panic on unsupported element types")
+		}
+	}()
+	FromTuple(struct{}{})
+}
+
+func TestKeyBuilderKeysAreIndependent(t *testing.T) {
+	b := NewKeyBuilder().AddString("tenant")
+	prefix := b.Key()
+	full := b.AddInt64(1).Key()
+	if !full.HasPrefix(prefix) || len(prefix) == len(full) {
+		t.Fatalf("Key() should return a snapshot that is a prefix of later keys")
+	}
+	if !slices.Equal(prefix, FromTuple("tenant")) {
+		t.Fatalf("later Add calls changed an earlier key")
+	}
+}
+
+func TestTupleDecodingErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		key  Key
+	}{
+		{"unknown type code", Key{0x7F}},
+		{"unterminated string", Key{tupleString, 'a'}},
+		{"truncated integer", FromTuple(int64(1))[:5]},
+		{"plain string key", FromString("abc")},
+	}
+	for _, tc := range tests {
+		if _, err := tc.key.Tuple(); !errors.Is(err, ErrInvalidTuple) {
+			t.Fatalf("%s: expected ErrInvalidTuple, got %v", tc.name, err)
+		}
+	}
+
+	r := NewTupleReader(FromTuple("a", int64(1)))
+	if _, err := r.ReadInt64(); !errors.Is(err, ErrInvalidTuple) {
+		t.Fatalf("reading a string element as integer should fail, got %v", err)
+	}
+	if s, err := r.ReadString(); err != nil || s != "a" {
+		t.Fatalf("a failed read should not advance the reader, got %q, %v", s, err)
+	}
+	if _, err := r.ReadFloat64(); !errors.Is(err, ErrInvalidTuple) {
+		t.Fatalf("reading an integer element as float should fail, got %v", err)
+	}
+	r.ReadInt64()
+	if _, err := r.ReadString(); !errors.Is(err, ErrInvalidTuple) || !r.Done() {
+		t.Fatalf("reading past the last element should fail, got %v", err)
+	}
+}
+
+func TestTupleWithDescendingElement(t *testing.T) {
+	// latest events per user: user ascending, timestamp descending
+	ordered := []Key{
+		FromTuple("alice", Desc(FromInt64(300)), "c"),
+		FromTuple("alice", Desc(FromInt64(200)), "b"),
+		FromTuple("alice", Desc(FromInt64(100)), "a"),
+		FromTuple("bob", Desc(FromInt64(400)), "d"),
+		FromTuple("bob", Desc(FromInt64(-1)), "e"),
+	}
+	for i := 1; i < len(ordered); i++ {
+		if !ordered[i-1].LessThan(ordered[i]) {
+			t.Fatalf("expected tuple %d < tuple %d", i-1, i)
+		}
+	}
+
+	got, err := ordered[0].Tuple()
+	if err != nil || len(got) != 3 || !Key(got[1].(Desc)).Equal(FromInt64(300)) || got[2] != "c" {
+		t.Fatalf("Tuple() = %#v, %v", got, err)
+	}
+	r := NewTupleReader(NewKeyBuilder().AddDescending(Key{0, 1}).AddInt64(5).Key())
+	if d, err := r.ReadDescending(); err != nil || !d.Equal(Key{0, 1}) {
+		t.Fatalf("ReadDescending() = %v, %v", d, err)
+	}
+	if i, err := r.ReadInt64(); err != nil || i != 5 || !r.Done() {
+		t.Fatalf("ReadInt64() after a descending element = %d, %v", i, err)
+	}
+	if _, err := (Key{tupleDesc, 0xFF}).Tuple(); !errors.Is(err, ErrInvalidTuple) {
+		t.Fatalf("expected ErrInvalidTuple for a truncated descending element, got %v", err)
+	}
+}
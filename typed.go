@@ -0,0 +1,173 @@
+package multimap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// KeyType is the type tag that the TypedFrom constructors put in front of the
+// encoded value.
+//
+// Typed keys are an opt-in alternative to the plain constructors for maps that
+// store keys of several types. Keys of different types never collide (unlike
+// FromInt64(0) and FromUint64(0)), and all keys of one type form a contiguous
+// band ordered by the tag: bytes < strings < signed integers < unsigned
+// integers < floats < times < durations. Within a band, keys are ordered by
+// value. All keys of one type can be queried with
+// MultiMap.KeysWithPrefix(Key{byte(t)}).
+//
+// The tags are 0xF8 and above. These bytes never start a valid UTF-8
+// sequence, so plain string keys never look like typed keys. Plain numeric
+// keys of very large values may start with a tag byte, however; typed and
+// plain keys should therefore not be mixed in one map.
+type KeyType byte
+
+const (
+	TypeBytes    KeyType = 0xF8 + iota // TypedFromBytes
+	TypeString                         // TypedFromString
+	TypeInt                            // TypedFromInt64
+	TypeUint                           // TypedFromUint64
+	TypeFloat                          // TypedFromFloat64
+	TypeTime                           // TypedFromTime
+	TypeDuration                       // TypedFromDuration
+)
+
+var keyTypeNames = [...]string{"bytes", "string", "int64", "uint64", "float64", "time", "duration"}
+
+// String returns the name of t, for example "int64".
+func (t KeyType) String() string {
+	if t.valid() {
+		return keyTypeNames[t-TypeBytes]
+	}
+	return "KeyType(0x" + strconv.FormatUint(uint64(t), 16) + ")"
+}
+
+func (t KeyType) valid() bool { return t >= TypeBytes && t <= TypeDuration }
+
+// ErrNotTyped is returned when a Key that was not produced by one of the
+// TypedFrom constructors is decoded with TypedValue.
+var ErrNotTyped = errors.New("multimap: key is not a typed key")
+
+// TypedFromBytes returns a copy of b tagged with TypeBytes.
+func TypedFromBytes(b []byte) Key {
+	return append(Key{byte(TypeBytes)}, b...)
+}
+
+// TypedFromString returns the UTF-8 encoding of s, normalized to Unicode NFC
+// like FromString, tagged with TypeString.
+func TypedFromString(s string) Key {
+	return append(Key{byte(TypeString)}, norm.NFC.String(s)...)
+}
+
+// TypedFromInt64 returns i tagged with TypeInt. The value is encoded like
+// FromInt64, so negative values sort before positive ones.
+func TypedFromInt64(i int64) Key {
+	return binary.BigEndian.AppendUint64(Key{byte(TypeInt)}, uint64(i)+1<<63)
+}
+
+// TypedFromUint64 returns u tagged with TypeUint. Since the tag already keeps
+// unsigned keys apart from signed ones, u is encoded without the 1<<63
+// offset, so all uint64 values, including those of 1<<63 and above, sort
+// numerically.
+func TypedFromUint64(u uint64) Key {
+	return binary.BigEndian.AppendUint64(Key{byte(TypeUint)}, u)
+}
+
+// TypedFromFloat64 returns f tagged with TypeFloat, encoded like FromFloat64.
+func TypedFromFloat64(f float64) Key {
+	return binary.BigEndian.AppendUint64(Key{byte(TypeFloat)}, float64Bits(f))
+}
+
+// TypedFromTime returns t tagged with TypeTime, encoded like FromTime.
+func TypedFromTime(t time.Time) Key {
+	return binary.BigEndian.AppendUint64(Key{byte(TypeTime)}, uint64(unixNano(t))+1<<63)
+}
+
+// TypedFromDuration returns d tagged with TypeDuration, encoded like
+// FromDuration.
+func TypedFromDuration(d time.Duration) Key {
+	return binary.BigEndian.AppendUint64(Key{byte(TypeDuration)}, uint64(d)+1<<63)
+}
+
+// Type returns the type tag of a typed key. It reports false if k does not
+// start with a type tag or its length or content does not fit the type.
+func (k Key) Type() (KeyType, bool) {
+	if len(k) == 0 {
+		return 0, false
+	}
+	t := KeyType(k[0])
+	switch t {
+	case TypeBytes:
+		return t, true
+	case TypeString:
+		return t, utf8.Valid(k[1:])
+	case TypeInt, TypeUint, TypeFloat, TypeTime, TypeDuration:
+		return t, len(k) == 9
+	}
+	return 0, false
+}
+
+// TypedValue decodes a typed key. Depending on its type, the result is a
+// []byte, string, int64, uint64, float64, time.Time (in UTC) or
+// time.Duration. It returns ErrNotTyped if k is not a valid typed key.
+func (k Key) TypedValue() (any, error) {
+	t, ok := k.Type()
+	if !ok {
+		return nil, ErrNotTyped
+	}
+	v := k[1:]
+	switch t {
+	case TypeBytes:
+		return v.Bytes(), nil
+	case TypeString:
+		return string(v), nil
+	case TypeUint:
+		return binary.BigEndian.Uint64(v), nil
+	case TypeFloat:
+		return v.Float64()
+	case TypeTime:
+		return v.Time()
+	case TypeDuration:
+		return v.Duration()
+	}
+	return v.Int64()
+}
+
+// TypedString formats a key produced by the TypedFrom constructors in a
+// readable form naming its type, e.g. `int64(42)` or `string("abc")`. Other
+// keys are formatted by String. Since plain keys may start with the tag bytes
+// as well, String never guesses and TypedString should only be used for maps
+// that store typed keys.
+func (k Key) TypedString() string {
+	if s, ok := k.typedString(); ok {
+		return s
+	}
+	return k.String()
+}
+
+// typedString formats a typed key for TypedString. It reports false if k is
+// not a valid typed key.
+func (k Key) typedString() (string, bool) {
+	t, ok := k.Type()
+	if !ok {
+		return "", false
+	}
+	v, _ := k.TypedValue()
+	switch x := v.(type) {
+	case []byte:
+		return t.String() + Key(x).String(), true
+	case string:
+		return t.String() + "(" + strconv.Quote(x) + ")", true
+	case float64:
+		return t.String() + "(" + strconv.FormatFloat(x, 'g', -1, 64) + ")", true
+	case time.Time:
+		return t.String() + "(" + x.Format(time.RFC3339Nano) + ")", true
+	}
+	return fmt.Sprintf("%s(%v)", t, v), true
+}
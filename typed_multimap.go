@@ -0,0 +1,347 @@
+package multimap
+
+import (
+	"iter"
+
+	set3 "github.com/TomTonic/Set3"
+)
+
+// TypedMultiMap is a MultiMap keyed by values of type K instead of Keys. It
+// wraps a MultiMap[V] and converts keys with a KeyCodec[K], so every call site
+// uses the same encoding:
+//
+//	m := NewTyped[string, int](StringCodec{})
+//	m.AddValue("alice", 1)
+//	for name, ids := range m.All() { ... }
+//
+// Ordering, range and prefix semantics are those of the encoded Keys. The
+// prefix methods are only meaningful for codecs whose encoding of a prefix is
+// a byte-wise prefix of the encoded key, such as StringCodec, BytesCodec and
+// TupleCodec.
+//
+// Keys are decoded whenever they are returned. A key that the codec cannot
+// decode can only be stored by writing to the underlying MultiMap directly;
+// methods returning keys skip it, and PopFirst and PopLast leave it in place.
+// Like the underlying MultiMap, a TypedMultiMap is safe for concurrent use.
+type TypedMultiMap[K any, V comparable] struct {
+	m     MultiMap[V]
+	codec KeyCodec[K]
+}
+
+// NewTyped returns a TypedMultiMap using codec on top of a new MultiMap with
+// the default array-based implementation.
+func NewTyped[K any, V comparable](codec KeyCodec[K]) *TypedMultiMap[K, V] {
+	return WrapTyped(New[V](), codec)
+}
+
+// WrapTyped returns a TypedMultiMap using codec on top of m, for example an
+// ART-based MultiMap from the art subpackage.
+func WrapTyped[K any, V comparable](m MultiMap[V], codec KeyCodec[K]) *TypedMultiMap[K, V] {
+	return &TypedMultiMap[K, V]{m: m, codec: codec}
+}
+
+// Unwrap returns the underlying MultiMap.
+func (t *TypedMultiMap[K, V]) Unwrap() MultiMap[V] { return t.m }
+
+// AddValue adds value to the set at key, see MultiMap.AddValue.
+func (t *TypedMultiMap[K, V]) AddValue(key K, value V) {
+	t.m.AddValue(t.codec.Encode(key), value)
+}
+
+// ContainsKey checks whether the map contains key.
+func (t *TypedMultiMap[K, V]) ContainsKey(key K) bool {
+	return t.m.ContainsKey(t.codec.Encode(key))
+}
+
+// ValuesFor returns the set of values stored at key, see MultiMap.ValuesFor.
+func (t *TypedMultiMap[K, V]) ValuesFor(key K) *set3.Set3[V] {
+	return t.m.ValuesFor(t.codec.Encode(key))
+}
+
+// ValuesBetweenInclusive returns all values whose keys are between from and
+// to, including both, see MultiMap.ValuesBetweenInclusive.
+func (t *TypedMultiMap[K, V]) ValuesBetweenInclusive(from, to K) *set3.Set3[V] {
+	return t.m.ValuesBetweenInclusive(t.codec.Encode(from), t.codec.Encode(to))
+}
+
+// ValuesBetweenExclusive returns all values whose keys are between from and
+// to, excluding both, see MultiMap.ValuesBetweenExclusive.
+func (t *TypedMultiMap[K, V]) ValuesBetweenExclusive(from, to K) *set3.Set3[V] {
+	return t.m.ValuesBetweenExclusive(t.codec.Encode(from), t.codec.Encode(to))
+}
+
+// ValuesFromInclusive returns all values whose keys are greater than or equal
+// to from.
+func (t *TypedMultiMap[K, V]) ValuesFromInclusive(from K) *set3.Set3[V] {
+	return t.m.ValuesFromInclusive(t.codec.Encode(from))
+}
+
+// ValuesFromExclusive returns all values whose keys are greater than from.
+func (t *TypedMultiMap[K, V]) ValuesFromExclusive(from K) *set3.Set3[V] {
+	return t.m.ValuesFromExclusive(t.codec.Encode(from))
+}
+
+// ValuesToInclusive returns all values whose keys are less than or equal to
+// to.
+func (t *TypedMultiMap[K, V]) ValuesToInclusive(to K) *set3.Set3[V] {
+	return t.m.ValuesToInclusive(t.codec.Encode(to))
+}
+
+// ValuesToExclusive returns all values whose keys are less than to.
+func (t *TypedMultiMap[K, V]) ValuesToExclusive(to K) *set3.Set3[V] {
+	return t.m.ValuesToExclusive(t.codec.Encode(to))
+}
+
+// ValuesWithPrefix returns all values whose encoded keys start with the
+// encoded prefix.
+func (t *TypedMultiMap[K, V]) ValuesWithPrefix(prefix K) *set3.Set3[V] {
+	return t.m.ValuesWithPrefix(t.codec.Encode(prefix))
+}
+
+// AllValues returns a set with all values stored in the map.
+func (t *TypedMultiMap[K, V]) AllValues() *set3.Set3[V] { return t.m.AllValues() }
+
+// Floor returns the greatest key less than or equal to key and its values,
+// see MultiMap.Floor. If there is none, found is false and floor is the zero
+// value of K.
+func (t *TypedMultiMap[K, V]) Floor(key K) (floor K, values *set3.Set3[V], found bool) {
+	k, values, found := t.m.Floor(t.codec.Encode(key))
+	return t.skipUndecodable(k, values, found, t.m.Lower)
+}
+
+// Ceiling returns the smallest key greater than or equal to key and its
+// values. It behaves like Floor otherwise.
+func (t *TypedMultiMap[K, V]) Ceiling(key K) (ceiling K, values *set3.Set3[V], found bool) {
+	k, values, found := t.m.Ceiling(t.codec.Encode(key))
+	return t.skipUndecodable(k, values, found, t.m.Higher)
+}
+
+// Lower returns the greatest key less than key and its values. It behaves
+// like Floor otherwise.
+func (t *TypedMultiMap[K, V]) Lower(key K) (lower K, values *set3.Set3[V], found bool) {
+	k, values, found := t.m.Lower(t.codec.Encode(key))
+	return t.skipUndecodable(k, values, found, t.m.Lower)
+}
+
+// Higher returns the smallest key greater than key and its values. It
+// behaves like Floor otherwise.
+func (t *TypedMultiMap[K, V]) Higher(key K) (higher K, values *set3.Set3[V], found bool) {
+	k, values, found := t.m.Higher(t.codec.Encode(key))
+	return t.skipUndecodable(k, values, found, t.m.Higher)
+}
+
+// LongestPrefixMatch returns the longest key whose encoding is a prefix of
+// the encoding of key, see MultiMap.LongestPrefixMatch.
+func (t *TypedMultiMap[K, V]) LongestPrefixMatch(key K) (prefix K, values *set3.Set3[V], found bool) {
+	k, values, found := t.m.LongestPrefixMatch(t.codec.Encode(key))
+	return t.skipUndecodable(k, values, found, func(k Key) (Key, *set3.Set3[V], bool) {
+		if len(k) == 0 {
+			return nil, set3.EmptyWithCapacity[V](0), false
+		}
+		// continue with the longest match shorter than k
+		return t.m.LongestPrefixMatch(k[:len(k)-1])
+	})
+}
+
+// FirstKey returns the smallest key. If the map is empty, found is false and
+// first is the zero value of K.
+func (t *TypedMultiMap[K, V]) FirstKey() (first K, found bool) {
+	k, found := t.m.FirstKey()
+	first, _, found = t.skipUndecodable(k, nil, found, t.m.Higher)
+	return first, found
+}
+
+// LastKey returns the greatest key. It behaves like FirstKey otherwise.
+func (t *TypedMultiMap[K, V]) LastKey() (last K, found bool) {
+	k, found := t.m.LastKey()
+	last, _, found = t.skipUndecodable(k, nil, found, t.m.Lower)
+	return last, found
+}
+
+// PopFirst removes the smallest key that the codec can decode and returns it
+// with its values, see MultiMap.PopFirst. Keys the codec cannot decode are
+// skipped and left in the map. With the MultiMap implementations of this
+// module, PopFirst is atomic. Other implementations are stepped through with
+// Higher, and the key found is then read with ValuesFor and removed with
+// RemoveKey, so concurrent writers may change it in between.
+func (t *TypedMultiMap[K, V]) PopFirst() (first K, values *set3.Set3[V], found bool) {
+	if p, ok := t.m.(matchingPopper[V]); ok {
+		return t.popped(p.PopFirstMatching(t.decodable))
+	}
+	return t.pop(t.m.FirstKey, t.m.Higher)
+}
+
+// PopLast removes the greatest key that the codec can decode and returns it
+// with its values, see MultiMap.PopLast. It behaves like PopFirst otherwise,
+// stepping through other implementations with Lower.
+func (t *TypedMultiMap[K, V]) PopLast() (last K, values *set3.Set3[V], found bool) {
+	if p, ok := t.m.(matchingPopper[V]); ok {
+		return t.popped(p.PopLastMatching(t.decodable))
+	}
+	return t.pop(t.m.LastKey, t.m.Lower)
+}
+
+// matchingPopper is implemented by the MultiMap implementations of this
+// module. PopFirstMatching and PopLastMatching atomically remove the first
+// or last key accepted by accept, leaving the rejected keys in place.
+type matchingPopper[V comparable] interface {
+	PopFirstMatching(accept func(Key) bool) (Key, *set3.Set3[V], bool)
+	PopLastMatching(accept func(Key) bool) (Key, *set3.Set3[V], bool)
+}
+
+// pop removes the first key that the codec can decode, starting at the key
+// returned by peek and stepping with next. It is not atomic, see PopFirst.
+func (t *TypedMultiMap[K, V]) pop(peek func() (Key, bool), next func(Key) (Key, *set3.Set3[V], bool)) (K, *set3.Set3[V], bool) {
+	k, found := peek()
+	for found && !t.decodable(k) {
+		k, _, found = next(k)
+	}
+	if !found {
+		var zero K
+		return zero, set3.EmptyWithCapacity[V](0), false
+	}
+	key, _ := t.decode(k)
+	values := t.m.ValuesFor(k)
+	t.m.RemoveKey(k)
+	return key, values, true
+}
+
+// popped decodes the key removed by PopFirstMatching or PopLastMatching,
+// which only accept keys that decode.
+func (t *TypedMultiMap[K, V]) popped(k Key, values *set3.Set3[V], found bool) (K, *set3.Set3[V], bool) {
+	key, _ := t.decode(k)
+	return key, values, found
+}
+
+// NumberOfKeys returns the number of keys stored in the map.
+func (t *TypedMultiMap[K, V]) NumberOfKeys() uint64 { return t.m.NumberOfKeys() }
+
+// AllKeys returns all keys in ascending order of their encodings.
+func (t *TypedMultiMap[K, V]) AllKeys() []K {
+	keys := t.m.AllKeys()
+	result := make([]K, 0, len(keys))
+	for _, k := range keys {
+		if key, ok := t.decode(k); ok {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// All returns an iterator over all keys and their sets of values, in
+// ascending order, see MultiMap.All.
+func (t *TypedMultiMap[K, V]) All() iter.Seq2[K, *set3.Set3[V]] {
+	return t.entries(t.m.All())
+}
+
+// Keys returns an iterator over all keys in ascending order.
+func (t *TypedMultiMap[K, V]) Keys() iter.Seq[K] {
+	return t.keys(t.m.Keys())
+}
+
+// KeysWithPrefix returns an iterator over all keys whose encodings start with
+// the encoded prefix, in ascending order.
+func (t *TypedMultiMap[K, V]) KeysWithPrefix(prefix K) iter.Seq[K] {
+	return t.keys(t.m.KeysWithPrefix(t.codec.Encode(prefix)))
+}
+
+// Values returns an iterator over the values of all keys, key by key, see
+// MultiMap.Values.
+func (t *TypedMultiMap[K, V]) Values() iter.Seq[V] { return t.m.Values() }
+
+// Range returns an iterator over all keys between from and to and their sets
+// of values, see MultiMap.Range.
+func (t *TypedMultiMap[K, V]) Range(from, to K, inclusive bool) iter.Seq2[K, *set3.Set3[V]] {
+	return t.entries(t.m.Range(t.codec.Encode(from), t.codec.Encode(to), inclusive))
+}
+
+// EntriesBetweenInclusive returns an iterator over all keys between from and
+// to, including both, and their sets of values.
+func (t *TypedMultiMap[K, V]) EntriesBetweenInclusive(from, to K) iter.Seq2[K, *set3.Set3[V]] {
+	return t.entries(t.m.EntriesBetweenInclusive(t.codec.Encode(from), t.codec.Encode(to)))
+}
+
+// EntriesBetweenExclusive is like EntriesBetweenInclusive but excludes from
+// and to.
+func (t *TypedMultiMap[K, V]) EntriesBetweenExclusive(from, to K) iter.Seq2[K, *set3.Set3[V]] {
+	return t.entries(t.m.EntriesBetweenExclusive(t.codec.Encode(from), t.codec.Encode(to)))
+}
+
+// EntriesFromInclusive returns an iterator over all keys greater than or
+// equal to from and their sets of values.
+func (t *TypedMultiMap[K, V]) EntriesFromInclusive(from K) iter.Seq2[K, *set3.Set3[V]] {
+	return t.entries(t.m.EntriesFromInclusive(t.codec.Encode(from)))
+}
+
+// EntriesFromExclusive is like EntriesFromInclusive but excludes from.
+func (t *TypedMultiMap[K, V]) EntriesFromExclusive(from K) iter.Seq2[K, *set3.Set3[V]] {
+	return t.entries(t.m.EntriesFromExclusive(t.codec.Encode(from)))
+}
+
+// EntriesToInclusive returns an iterator over all keys less than or equal to
+// to and their sets of values.
+func (t *TypedMultiMap[K, V]) EntriesToInclusive(to K) iter.Seq2[K, *set3.Set3[V]] {
+	return t.entries(t.m.EntriesToInclusive(t.codec.Encode(to)))
+}
+
+// EntriesToExclusive is like EntriesToInclusive but excludes to.
+func (t *TypedMultiMap[K, V]) EntriesToExclusive(to K) iter.Seq2[K, *set3.Set3[V]] {
+	return t.entries(t.m.EntriesToExclusive(t.codec.Encode(to)))
+}
+
+// RemoveValue removes value from the set at key, see MultiMap.RemoveValue.
+func (t *TypedMultiMap[K, V]) RemoveValue(key K, value V) {
+	t.m.RemoveValue(t.codec.Encode(key), value)
+}
+
+// RemoveKey removes key and its values.
+func (t *TypedMultiMap[K, V]) RemoveKey(key K) { t.m.RemoveKey(t.codec.Encode(key)) }
+
+// Clear removes all keys and values.
+func (t *TypedMultiMap[K, V]) Clear() { t.m.Clear() }
+
+// decode decodes k and reports whether the codec accepted it.
+func (t *TypedMultiMap[K, V]) decode(k Key) (K, bool) {
+	key, err := t.codec.Decode(k)
+	return key, err == nil
+}
+
+// decodable reports whether the codec accepts k.
+func (t *TypedMultiMap[K, V]) decodable(k Key) bool {
+	_, ok := t.decode(k)
+	return ok
+}
+
+// skipUndecodable decodes the key of a single-entry result. While the codec
+// rejects the key, it moves on to the entry returned by next for that key.
+func (t *TypedMultiMap[K, V]) skipUndecodable(k Key, values *set3.Set3[V], found bool, next func(Key) (Key, *set3.Set3[V], bool)) (K, *set3.Set3[V], bool) {
+	for ; found; k, values, found = next(k) {
+		if key, ok := t.decode(k); ok {
+			return key, values, true
+		}
+	}
+	var zero K
+	return zero, values, false
+}
+
+// entries decodes the keys yielded by seq, skipping those the codec rejects.
+func (t *TypedMultiMap[K, V]) entries(seq iter.Seq2[Key, *set3.Set3[V]]) iter.Seq2[K, *set3.Set3[V]] {
+	return func(yield func(K, *set3.Set3[V]) bool) {
+		for k, values := range seq {
+			if key, ok := t.decode(k); ok && !yield(key, values) {
+				return
+			}
+		}
+	}
+}
+
+// keys decodes the keys yielded by seq, skipping those the codec rejects.
+func (t *TypedMultiMap[K, V]) keys(seq iter.Seq[Key]) iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for k := range seq {
+			if key, ok := t.decode(k); ok && !yield(key) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package multimap
+
+import (
+	"slices"
+	"testing"
+
+	set3 "github.com/TomTonic/Set3"
+)
+
+func TestTypedMultiMapStringKeys(t *testing.T) {
+	m := NewTyped[string, int](StringCodec{})
+	m.AddValue("carol", 3)
+	m.AddValue("alice", 1)
+	m.AddValue("alice", 11)
+	m.AddValue("bob", 2)
+
+	if !m.ContainsKey("alice") || !m.ValuesFor("alice").Equals(set3.From(1, 11)) {
+		t.Fatalf("expected values 1 and 11 for alice")
+	}
+	if got := m.AllKeys(); !slices.Equal(got, []string{"alice", "bob", "carol"}) {
+		t.Fatalf("AllKeys() = %v", got)
+	}
+	if !m.ValuesBetweenInclusive("b", "c").Equals(set3.From(2)) {
+		t.Fatalf("expected only bob's value between b and c")
+	}
+	if k, values, found := m.Floor("bz"); !found || k != "bob" || !values.Equals(set3.From(2)) {
+		t.Fatalf("Floor(bz) = %q, %v, %v", k, values, found)
+	}
+	if k, _, found := m.Lower("alice"); found || k != "" {
+		t.Fatalf("Lower(alice) should find nothing, got %q", k)
+	}
+
+	var names []string
+	for name, values := range m.All() {
+		names = append(names, name)
+		if values.Size() == 0 {
+			t.Fatalf("empty value set for %q", name)
+		}
+	}
+	if !slices.Equal(names, []string{"alice", "bob", "carol"}) {
+		t.Fatalf("All() yielded %v", names)
+	}
+
+	if k, _, found := m.PopFirst(); !found || k != "alice" || m.ContainsKey("alice") {
+		t.Fatalf("PopFirst() = %q, %v", k, found)
+	}
+	m.RemoveKey("bob")
+	if m.NumberOfKeys() != 1 {
+		t.Fatalf("expected only carol left, got %d keys", m.NumberOfKeys())
+	}
+}
+
+func TestTypedMultiMapTupleKeys(t *testing.T) {
+	m := NewTyped[Tuple, string](TupleCodec{})
+	m.AddValue(Tuple{"tenant-a", int64(2)}, "x")
+	m.AddValue(Tuple{"tenant-a", int64(10)}, "y")
+	m.AddValue(Tuple{"tenant-b", int64(1)}, "z")
+
+	var ids []int64
+	for k := range m.KeysWithPrefix(Tuple{"tenant-a"}) {
+		ids = append(ids, k[1].(int64))
+	}
+	if !slices.Equal(ids, []int64{2, 10}) {
+		t.Fatalf("KeysWithPrefix(tenant-a) yielded ids %v", ids)
+	}
+	if !m.ValuesWithPrefix(Tuple{"tenant-b"}).Equals(set3.From("z")) {
+		t.Fatalf("expected value z for tenant-b")
+	}
+}
+
+func TestTypedMultiMapSkipsUndecodableKeys(t *testing.T) {
+	m := NewTyped[int64, int](IntCodec[int64]{})
+	m.AddValue(1, 10)
+	m.AddValue(3, 30)
+	// sorts before all integer keys
+	bad := FromString("not an int")
+	m.Unwrap().AddValue(bad, 1)
+	if keys := m.AllKeys(); !slices.Equal(keys, []int64{1, 3}) {
+		t.Fatalf("AllKeys() = %v, want [1 3]", keys)
+	}
+	if k, found := m.FirstKey(); !found || k != 1 {
+		t.Fatalf("FirstKey() = %d, %v", k, found)
+	}
+	if _, _, found := m.Lower(1); found {
+		t.Fatalf("Lower(1) should skip the undecodable key")
+	}
+	if k, values, found := m.PopFirst(); !found || k != 1 || !values.Equals(set3.From(10)) {
+		t.Fatalf("PopFirst() = %d, %v, %v", k, values, found)
+	}
+	if !m.Unwrap().ContainsKey(bad) {
+		t.Fatalf("PopFirst should leave the undecodable key in place")
+	}
+}
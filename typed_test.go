@@ -0,0 +1,133 @@
+package multimap
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTypedKeysDoNotCollide(t *testing.T) {
+	keys := []Key{
+		TypedFromBytes([]byte{0x80, 0, 0, 0, 0, 0, 0, 0}),
+		TypedFromString("\x80"),
+		TypedFromInt64(0),
+		TypedFromUint64(0),
+		TypedFromFloat64(0),
+		TypedFromTime(time.Unix(0, 0)),
+		TypedFromDuration(0),
+	}
+	for i := range keys {
+		for j := range keys {
+			if i != j && keys[i].Equal(keys[j]) {
+				t.Fatalf("typed keys %d and %d collide: %v", i, j, keys[i])
+			}
+		}
+	}
+	if FromInt64(0).Equal(TypedFromInt64(0)) {
+		t.Fatalf("typed and plain keys should differ")
+	}
+}
+
+func TestTypedKeysFormContiguousBands(t *testing.T) {
+	ordered := []Key{
+		TypedFromBytes(nil),
+		TypedFromBytes([]byte{0xFF, 0xFF}),
+		TypedFromString(""),
+		TypedFromString("100"),
+		TypedFromString("25"),
+		TypedFromInt64(math.MinInt64),
+		TypedFromInt64(50),
+		TypedFromInt64(math.MaxInt64),
+		TypedFromUint64(0),
+		TypedFromUint64(1 << 63),
+		TypedFromUint64(math.MaxUint64),
+		TypedFromFloat64(math.Inf(-1)),
+		TypedFromFloat64(math.Inf(1)),
+		TypedFromTime(time.Unix(-1, 0)),
+		TypedFromTime(time.Unix(1, 0)),
+		TypedFromDuration(-time.Hour),
+		TypedFromDuration(time.Hour),
+	}
+	for i := 1; i < len(ordered); i++ {
+		if !ordered[i-1].LessThan(ordered[i]) {
+			t.Fatalf("expected %v < %v", ordered[i-1], ordered[i])
+		}
+	}
+}
+
+func TestTypedValueRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	tests := []struct {
+		key  Key
+		want any
+		typ  KeyType
+	}{
+		{TypedFromBytes([]byte{1, 2}), []byte{1, 2}, TypeBytes},
+		{TypedFromString("ä"), "ä", TypeString},
+		{TypedFromInt64(-42), int64(-42), TypeInt},
+		{TypedFromUint64(math.MaxUint64), uint64(math.MaxUint64), TypeUint},
+		{TypedFromFloat64(-0.5), -0.5, TypeFloat},
+		{TypedFromTime(ts.In(time.FixedZone("X", 7200))), ts, TypeTime},
+		{TypedFromDuration(-time.Minute), -time.Minute, TypeDuration},
+	}
+	for _, tc := range tests {
+		typ, ok := tc.key.Type()
+		got, err := tc.key.TypedValue()
+		if !ok || typ != tc.typ || err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%v: Type() = %v, %v; TypedValue() = %#v, %v; want %v %#v", tc.key, typ, ok, got, err, tc.typ, tc.want)
+		}
+	}
+}
+
+func TestTypedKeyStringFormatting(t *testing.T) {
+	tests := []struct {
+		key  Key
+		want string
+	}{
+		{TypedFromInt64(-5), "int64(-5)"},
+		{TypedFromUint64(7), "uint64(7)"},
+		{TypedFromString("a\"b"), `string("a\"b")`},
+		{TypedFromBytes([]byte{0x01, 0xAB}), "bytes[01,AB]"},
+		{TypedFromFloat64(2.5), "float64(2.5)"},
+		{TypedFromTime(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)), "time(2024-01-02T03:04:05Z)"},
+		{TypedFromDuration(90 * time.Second), "duration(1m30s)"},
+		{FromInt64(1), "[80,00,00,00,00,00,00,01]"},
+		{Key{byte(TypeInt), 1}, "[FA,01]"},
+		{Key{byte(TypeString), 0xFF}, "[F9,FF]"},
+	}
+	for _, tc := range tests {
+		if got := tc.key.TypedString(); got != tc.want {
+			t.Fatalf("TypedString() = %s, want %s", got, tc.want)
+		}
+	}
+	// String never guesses: plain keys starting with a tag byte stay hex
+	plain := []struct {
+		key  Key
+		want string
+	}{
+		{TypedFromInt64(-5), "[FA,7F,FF,FF,FF,FF,FF,FF,FB]"},
+		{FromBytes([]byte{0xF8, 1}), "[F8,01]"},
+		{FromBytes([]byte{0xF9, 'a'}), "[F9,61]"},
+	}
+	for _, tc := range plain {
+		if got := tc.key.String(); got != tc.want {
+			t.Fatalf("String() = %s, want %s", got, tc.want)
+		}
+	}
+	if TypeUint.String() != "uint64" || KeyType(0x01).String() != "KeyType(0x1)" {
+		t.Fatalf("unexpected KeyType names %s, %s", TypeUint, KeyType(0x01))
+	}
+}
+
+func TestTypedValueRejectsPlainKeys(t *testing.T) {
+	for _, k := range []Key{nil, FromString("abc"), FromInt64(-1), Key{byte(TypeFloat), 1, 2}} {
+		if _, ok := k.Type(); ok {
+			t.Fatalf("%v should not be reported as typed", k)
+		}
+		if _, err := k.TypedValue(); !errors.Is(err, ErrNotTyped) {
+			t.Fatalf("TypedValue(%v): expected ErrNotTyped, got %v", k, err)
+		}
+	}
+}